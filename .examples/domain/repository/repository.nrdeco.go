@@ -5,17 +5,23 @@ package repository
 
 import (
 	"context"
-	"github.com/miyamo2/nrdeco/examples/domain/model"
-	"github.com/newrelic/go-agent/v3/newrelic"
 	"os"
 	"strings"
+
+	"github.com/miyamo2/nrdeco/examples/domain/model"
+	"github.com/newrelic/go-agent/v3/newrelic"
 )
 
-// NRUserRepository implements repository.UserRepository with New Relic instrumentation.
+// NRUserRepository implements UserRepository with New Relic instrumentation.
 type NRUserRepository struct {
 	UserRepository
 }
 
+// Unwrap returns the UserRepository decorated by NRUserRepository.
+func (n *NRUserRepository) Unwrap() UserRepository {
+	return n.UserRepository
+}
+
 func (n *NRUserRepository) GetUserByIDWithContext(ctx context.Context, arg1 string) (*model.User, error) {
 	if strings.ToLower(os.Getenv("NRDECO_ENABLED")) == "true" {
 		defer newrelic.FromContext(ctx).StartSegment("repository.UserRepository.GetUserByIDWithContext").End()
@@ -0,0 +1,2 @@
+//go:generate go tool nrdeco --from-package database/sql/driver --interfaces QueryerContext,ExecerContext -d driver.nrdeco.go
+package driver
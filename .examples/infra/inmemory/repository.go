@@ -1,3 +1,4 @@
+//go:generate go tool nrdeco -s $GOFILE -t UserRepository
 package inmemory
 
 import (
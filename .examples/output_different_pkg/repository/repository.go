@@ -5,11 +5,12 @@ package repository
 
 import (
 	"context"
-	"github.com/miyamo2/nrdeco/examples/domain/model"
-	"github.com/newrelic/go-agent/v3/newrelic"
 	"os"
-	"github.com/miyamo2/nrdeco/examples/domain/repository"
 	"strings"
+
+	"github.com/miyamo2/nrdeco/examples/domain/model"
+	"github.com/miyamo2/nrdeco/examples/domain/repository"
+	"github.com/newrelic/go-agent/v3/newrelic"
 )
 
 // NRUserRepository implements repository.UserRepository with New Relic instrumentation.
@@ -17,6 +18,11 @@ type NRUserRepository struct {
 	repository.UserRepository
 }
 
+// Unwrap returns the repository.UserRepository decorated by NRUserRepository.
+func (n *NRUserRepository) Unwrap() repository.UserRepository {
+	return n.UserRepository
+}
+
 func (n *NRUserRepository) GetUserByIDWithContext(ctx context.Context, arg1 string) (*model.User, error) {
 	if strings.ToLower(os.Getenv("NRDECO_ENABLED")) == "true" {
 		defer newrelic.FromContext(ctx).StartSegment("repository.UserRepository.GetUserByIDWithContext").End()
@@ -5,10 +5,11 @@ package usecase
 
 import (
 	"context"
-	"github.com/newrelic/go-agent/v3/newrelic"
 	"os"
 	"strings"
+
 	"github.com/miyamo2/nrdeco/examples/usecase"
+	"github.com/newrelic/go-agent/v3/newrelic"
 )
 
 // NRUserUseCase implements usecase.UserUseCase with New Relic instrumentation.
@@ -16,6 +17,11 @@ type NRUserUseCase struct {
 	usecase.UserUseCase
 }
 
+// Unwrap returns the usecase.UserUseCase decorated by NRUserUseCase.
+func (n *NRUserUseCase) Unwrap() usecase.UserUseCase {
+	return n.UserUseCase
+}
+
 func (n *NRUserUseCase) GetUserByIDWithContext(ctx context.Context, arg1 string) (*usecase.UserDto, error) {
 	if strings.ToLower(os.Getenv("NRDECO_ENABLED")) == "true" {
 		defer newrelic.FromContext(ctx).StartSegment("usecase.UserUseCase.GetUserByIDWithContext").End()
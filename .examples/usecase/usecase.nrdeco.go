@@ -5,16 +5,22 @@ package usecase
 
 import (
 	"context"
-	"github.com/newrelic/go-agent/v3/newrelic"
 	"os"
 	"strings"
+
+	"github.com/newrelic/go-agent/v3/newrelic"
 )
 
-// NRUserUseCase implements usecase.UserUseCase with New Relic instrumentation.
+// NRUserUseCase implements UserUseCase with New Relic instrumentation.
 type NRUserUseCase struct {
 	UserUseCase
 }
 
+// Unwrap returns the UserUseCase decorated by NRUserUseCase.
+func (n *NRUserUseCase) Unwrap() UserUseCase {
+	return n.UserUseCase
+}
+
 func (n *NRUserUseCase) GetUserByIDWithContext(ctx context.Context, arg1 string) (*UserDto, error) {
 	if strings.ToLower(os.Getenv("NRDECO_ENABLED")) == "true" {
 		defer newrelic.FromContext(ctx).StartSegment("usecase.UserUseCase.GetUserByIDWithContext").End()
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"slices"
+
+	"github.com/miyamo2/nrdeco/internal"
+	"github.com/spf13/cobra"
+)
+
+func cleanCmd() *cobra.Command {
+	var dryRunFlag bool
+	command := &cobra.Command{
+		Use:   "clean",
+		Short: "Delete the orphaned files generated by nrdeco.",
+		Long: `Delete the orphaned files generated by nrdeco in the module containing the current directory.
+
+With --manifest or manifest: true in the configuration file,
+nrdeco records the files it generates in ` + internal.ManifestFileName + ` at the root of the module.
+A recorded file is orphaned if its source file or package no longer exists, or none of the types it decorates is declared there anymore.
+Files without the "Code generated by nrdeco" header are never deleted.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cmd.SilenceUsage = true
+			m, unlock, err := internal.LockManifest(".")
+			if err != nil {
+				return fmt.Errorf("[nrdeco] failed to load the manifest: %w", err)
+			}
+			if m == nil {
+				return errors.New("[nrdeco] go.mod not found")
+			}
+			defer unlock()
+
+			for _, entry := range slices.Clone(m.Files) {
+				dest := m.Abs(entry.Dest)
+				generated, err := internal.IsGeneratedByNrdeco(dest)
+				switch {
+				case errors.Is(err, fs.ErrNotExist):
+					m.Remove(entry.Dest)
+					continue
+				case err != nil:
+					return fmt.Errorf("[nrdeco] %w", err)
+				case !generated:
+					cmd.PrintErrf(
+						"[nrdeco] warning: %s is not generated by nrdeco; left untouched\n",
+						relativePath(dest),
+					)
+					m.Remove(entry.Dest)
+					continue
+				}
+				reason, err := m.Orphaned(entry)
+				if err != nil {
+					return fmt.Errorf("[nrdeco] failed to check %s: %w", relativePath(dest), err)
+				}
+				if reason == "" {
+					continue
+				}
+				if dryRunFlag {
+					cmd.Printf("[nrdeco] would remove: %s (%s)\n", relativePath(dest), reason)
+					continue
+				}
+				if err := os.Remove(dest); err != nil {
+					return fmt.Errorf("[nrdeco] failed to remove %s: %w", relativePath(dest), err)
+				}
+				m.Remove(entry.Dest)
+				cmd.Printf("[nrdeco] removed: %s (%s)\n", relativePath(dest), reason)
+			}
+			if dryRunFlag {
+				return nil
+			}
+			if err := m.Save(); err != nil {
+				return fmt.Errorf("[nrdeco] failed to update the manifest: %w", err)
+			}
+			return nil
+		},
+	}
+	command.Flags().
+		BoolVar(&dryRunFlag, "dry-run", false, `Print the files to be deleted without deleting them.`)
+	return command
+}
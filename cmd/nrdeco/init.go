@@ -0,0 +1,229 @@
+package main
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/miyamo2/nrdeco/internal"
+	"github.com/spf13/cobra"
+	"golang.org/x/mod/semver"
+)
+
+func initCmd() *cobra.Command {
+	var (
+		dryRunFlag bool
+		wiringFlag string
+	)
+	command := &cobra.Command{
+		Use:   "init [package...]",
+		Short: "Set up nrdeco in the module.",
+		Long: `Set up nrdeco in the module containing the current directory.
+
+init makes the following changes, each of which is skipped if it has already been made:
+
+  - writes nrdeco.yaml to the root of the module unless a configuration file is found
+  - adds nrdeco to the tools of the module with go get -tool
+  - inserts "//go:generate go tool nrdeco" above the package clause of each file declaring interfaces or function types
+    to be decorated, unless the file already has a go:generate directive running nrdeco
+  - writes the providers of the decorated values to the file given by --wiring, unless it exists
+
+Each argument is a package pattern, and it defaults to ./...`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cmd.SilenceUsage = true
+			patterns := args
+			if len(patterns) == 0 {
+				patterns = []string{"./..."}
+			}
+			gomod, err := internal.FindModule(".")
+			if err != nil {
+				return fmt.Errorf("[nrdeco] %w", err)
+			}
+			if gomod == "" {
+				return errors.New("[nrdeco] go.mod not found")
+			}
+			root := filepath.Dir(gomod)
+			s := &scaffolder{
+				cmd:    cmd,
+				dryRun: dryRunFlag,
+			}
+
+			cfgPath, err := internal.FindConfig(root)
+			if err != nil {
+				return fmt.Errorf("[nrdeco] %w", err)
+			}
+			if cfgPath == "" {
+				dest := relativePath(filepath.Join(root, "nrdeco.yaml"))
+				if err := s.write(dest, []byte(internal.ConfigTemplate)); err != nil {
+					return err
+				}
+			}
+
+			hasTool, err := internal.HasTool(gomod)
+			if err != nil {
+				return fmt.Errorf("[nrdeco] %w", err)
+			}
+			if !hasTool {
+				tool := fmt.Sprintf("%s@%s", internal.ToolPath, toolVersion())
+				if err := s.run(root, "go", "get", "-tool", tool); err != nil {
+					return err
+				}
+			}
+
+			pkgs, err := internal.LoadPackages(patterns...)
+			if err != nil {
+				return report(cmd, formatText, "failed to load packages", err)
+			}
+			var sources []internal.WiringSource
+			for _, pkg := range pkgs {
+				for _, file := range pkg.Files {
+					file = relativePath(file)
+					cfg, err := loadConfig("", file)
+					if err != nil {
+						return fmt.Errorf("[nrdeco] invalid configuration:\n%w", err)
+					}
+					f, err := internal.Decorated(file, initOptions(cfg)...)
+					if err != nil {
+						return report(cmd, formatText, fmt.Sprintf("failed to scan %s", file), err)
+					}
+					if f == nil || len(f.Interfaces) == 0 {
+						continue
+					}
+					b, err := internal.InsertDirective(file)
+					if err != nil {
+						summary := fmt.Sprintf("failed to insert the directive into %s", file)
+						return report(cmd, formatText, summary, err)
+					}
+					if err := s.write(file, b); err != nil {
+						return err
+					}
+					sources = append(sources, internal.WiringSource{
+						Package: internal.Package{
+							Path: pkg.Path,
+							Name: pkg.Name,
+						},
+						Dir:  filepath.Dir(file),
+						File: f,
+					})
+				}
+			}
+
+			if wiringFlag == "" {
+				return nil
+			}
+			_, err = os.Stat(wiringFlag)
+			switch {
+			case err == nil:
+				cmd.Printf("[nrdeco] exists: %s\n", wiringFlag)
+				return nil
+			case !errors.Is(err, fs.ErrNotExist):
+				return fmt.Errorf("[nrdeco] failed to stat %s: %w", wiringFlag, err)
+			}
+			b, err := internal.Wiring(wiringFlag, sources)
+			if err != nil {
+				return fmt.Errorf("[nrdeco] failed to scaffold %s: %w", wiringFlag, err)
+			}
+			if !dryRunFlag {
+				if err := os.MkdirAll(filepath.Dir(wiringFlag), 0o755); err != nil {
+					return fmt.Errorf(
+						"[nrdeco] failed to create the directory of %s: %w",
+						wiringFlag,
+						err,
+					)
+				}
+			}
+			return s.write(wiringFlag, b)
+		},
+	}
+	command.Flags().
+		BoolVar(&dryRunFlag, "dry-run", false, `Print the changes as unified diffs and the commands to be run without making them.`)
+	command.Flags().
+		StringVar(&wiringFlag, "wiring", "", `A file to which the providers of the decorated values are written, such as di/nrdeco.go. It is not overwritten if it exists.`)
+	return command
+}
+
+// scaffolder makes the changes of init, or prints them if dryRun is true.
+type scaffolder struct {
+	cmd    *cobra.Command
+	dryRun bool
+}
+
+// write writes b to path.
+func (s *scaffolder) write(path string, b []byte) error {
+	if s.dryRun {
+		diff, err := internal.Diff(path, b)
+		if err != nil {
+			return fmt.Errorf("[nrdeco] failed to compute the changes of %s: %w", path, err)
+		}
+		s.cmd.Print(diff)
+		return nil
+	}
+	written, err := internal.WriteFile(path, b)
+	if err != nil {
+		return fmt.Errorf("[nrdeco] failed to write %s: %w", path, err)
+	}
+	if written {
+		s.cmd.Printf("[nrdeco] wrote: %s\n", path)
+	}
+	return nil
+}
+
+// run runs the command in dir.
+func (s *scaffolder) run(dir, name string, args ...string) error {
+	line := strings.Join(append([]string{name}, args...), " ")
+	if s.dryRun {
+		s.cmd.Printf("[nrdeco] would run: %s\n", line)
+		return nil
+	}
+	c := exec.CommandContext(s.cmd.Context(), name, args...)
+	c.Dir = dir
+	c.Stdout = s.cmd.OutOrStdout()
+	c.Stderr = s.cmd.ErrOrStderr()
+	if err := c.Run(); err != nil {
+		return fmt.Errorf("[nrdeco] failed to run %s: %w", line, err)
+	}
+	s.cmd.Printf("[nrdeco] ran: %s\n", line)
+	return nil
+}
+
+// toolVersion returns the version of nrdeco to be added to the tools of the module.
+func toolVersion() string {
+	v := Version
+	if !strings.HasPrefix(v, "v") {
+		v = "v" + v
+	}
+	if semver.IsValid(v) {
+		return v
+	}
+	return "latest"
+}
+
+// initOptions returns the options to find the decorators as configured by cfg, which may be nil.
+func initOptions(cfg *internal.Config) []internal.Option {
+	opts := segmentOptions(cfg)
+	if cfg == nil {
+		return opts
+	}
+	if cfg.Explicit {
+		opts = append(opts, internal.WithExplicit())
+	}
+	if len(cfg.Interfaces) > 0 {
+		opts = append(opts, internal.WithInterfaces(cfg.Interfaces...))
+	}
+	switch {
+	case cfg.TypeName != "":
+		opts = append(opts, internal.WithTypeNameTemplate(cfg.TypeName))
+	case cfg.Prefix != "" || cfg.Suffix != "":
+		opts = append(
+			opts,
+			internal.WithPrefix(cmp.Or(cfg.Prefix, internal.DefaultPrefix)),
+			internal.WithSuffix(cfg.Suffix),
+		)
+	}
+	return opts
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/miyamo2/nrdeco/internal"
+	"github.com/spf13/cobra"
+)
+
+func injectCmd() *cobra.Command {
+	var (
+		checkFlag  bool
+		configFlag string
+	)
+	command := &cobra.Command{
+		Use:   "inject [path...]",
+		Short: "Insert segments into the functions and methods accepting context.Context in place.",
+		Long: `Insert segments into the functions and methods accepting context.Context in place.
+
+Each path is a Go file, a directory, or a directory followed by /... to include its subdirectories.
+The inserted statements are marked with //nrdeco:inject, so that inject can be run again to bring them up to date and strip removes them.
+Test files, generated files and functions already starting their own segments are left untouched.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			files, err := goFiles(args)
+			if err != nil {
+				return fmt.Errorf("[nrdeco] %w", err)
+			}
+			return rewriteFiles(cmd, files, checkFlag, func(file string) ([]byte, error) {
+				cfg, err := loadConfig(configFlag, file)
+				if err != nil {
+					return nil, fmt.Errorf("invalid configuration:\n%w", err)
+				}
+				opts := append(segmentOptions(cfg), internal.WithWarn(func(msg string) {
+					cmd.PrintErrf("[nrdeco] warning: %s\n", msg)
+				}))
+				return internal.Inject(file, opts...)
+			})
+		},
+	}
+	command.Flags().
+		BoolVar(&checkFlag, "check", false, `Check that the files are instrumented without writing them. If any of them differs, a unified diff is printed and nrdeco exits with a non-zero status.`)
+	command.Flags().
+		StringVar(&configFlag, "config", "", `A configuration file. If not provided, nrdeco.yaml or .nrdeco.toml is searched for from the directory of each file up to the root.`)
+	return command
+}
+
+func stripCmd() *cobra.Command {
+	var checkFlag bool
+	command := &cobra.Command{
+		Use:   "strip [path...]",
+		Short: "Remove the segments inserted by inject in place.",
+		Long: `Remove the segments inserted by inject in place.
+
+Each path is a Go file, a directory, or a directory followed by /... to include its subdirectories.
+Only the statements marked with //nrdeco:inject are removed.
+The layout expanded by inject is kept as gofmt formats it, so a one-line function body stays split over several lines
+and a single import stays parenthesized; the result is not byte-identical to the file before inject.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			files, err := goFiles(args)
+			if err != nil {
+				return fmt.Errorf("[nrdeco] %w", err)
+			}
+			return rewriteFiles(cmd, files, checkFlag, internal.Strip)
+		},
+	}
+	command.Flags().
+		BoolVar(&checkFlag, "check", false, `Check that the files have no segments inserted by inject without writing them. If any of them has, a unified diff is printed and nrdeco exits with a non-zero status.`)
+	return command
+}
+
+// rewriteFiles writes each of files rewritten by rewrite, or prints the differences if check is true.
+func rewriteFiles(
+	cmd *cobra.Command,
+	files []string,
+	check bool,
+	rewrite func(file string) ([]byte, error),
+) error {
+	outdated := 0
+	for _, file := range files {
+		b, err := rewrite(file)
+		if err != nil {
+			cmd.SilenceUsage = true
+			return report(cmd, formatText, fmt.Sprintf("failed to rewrite %s", file), err)
+		}
+		if check {
+			diff, err := internal.Diff(file, b)
+			if err != nil {
+				return fmt.Errorf("[nrdeco] failed to check %s: %w", file, err)
+			}
+			if diff != "" {
+				cmd.Print(diff)
+				outdated++
+			}
+			continue
+		}
+		written, err := internal.WriteFile(file, b)
+		if err != nil {
+			return fmt.Errorf("[nrdeco] failed to write %s: %w", file, err)
+		}
+		if written {
+			cmd.Printf("[nrdeco] wrote: %s\n", file)
+		}
+	}
+	if outdated > 0 {
+		cmd.SilenceUsage = true
+		return fmt.Errorf("[nrdeco] %d file(s) out of date", outdated)
+	}
+	return nil
+}
+
+// goFiles returns the Go files other than tests specified by paths.
+// Each path is a file, a directory, or a directory followed by /... to walk its subdirectories,
+// skipping those named testdata or vendor and those beginning with . or _ as the go command does.
+// It defaults to the current directory.
+func goFiles(paths []string) ([]string, error) {
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+	var files []string
+	for _, path := range paths {
+		if root, ok := strings.CutSuffix(path, "/..."); ok {
+			err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+				if err != nil {
+					return err
+				}
+				if d.IsDir() {
+					name := d.Name()
+					ignored := name == "testdata" || name == "vendor" ||
+						strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_")
+					if p != root && ignored {
+						return filepath.SkipDir
+					}
+					return nil
+				}
+				if isGoFile(d.Name()) {
+					files = append(files, p)
+				}
+				return nil
+			})
+			if err != nil {
+				return nil, fmt.Errorf("failed to walk %s: %w", root, err)
+			}
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			if !entry.IsDir() && isGoFile(entry.Name()) {
+				files = append(files, filepath.Join(path, entry.Name()))
+			}
+		}
+	}
+	return files, nil
+}
+
+func isGoFile(name string) bool {
+	return strings.HasSuffix(name, ".go") && !strings.HasSuffix(name, "_test.go")
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/miyamo2/nrdeco/internal"
+	"github.com/spf13/cobra"
+)
+
+func listCmd() *cobra.Command {
+	var (
+		formatFlag string
+		configFlag string
+	)
+	command := &cobra.Command{
+		Use:   "list [file.go|package...]",
+		Short: "List the methods of the interfaces and whether they are instrumented.",
+		Long: `List the methods of the interfaces and the function types, whether nrdeco instruments them, and the names of their segments.
+
+Each argument is a Go file or a package pattern such as ./... It defaults to the package in the current directory.
+Segment names follow the configuration found for each file, as if the decorators were generated next to it.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			switch formatFlag {
+			case formatText, formatJSON:
+			default:
+				return fmt.Errorf(
+					"[nrdeco] unsupported format '%s': must be %s or %s",
+					formatFlag,
+					formatText,
+					formatJSON,
+				)
+			}
+			files, err := sourceFiles(args)
+			if err != nil {
+				cmd.SilenceUsage = true
+				return report(cmd, formatFlag, "failed to load packages", err)
+			}
+
+			entries := make([]internal.Entry, 0)
+			for _, file := range files {
+				cfg, err := loadConfig(configFlag, file)
+				if err != nil {
+					cmd.SilenceUsage = true
+					return fmt.Errorf("[nrdeco] invalid configuration:\n%w", err)
+				}
+				list, err := internal.List(file, segmentOptions(cfg)...)
+				if err != nil {
+					cmd.SilenceUsage = true
+					return report(cmd, formatFlag, fmt.Sprintf("failed to list %s", file), err)
+				}
+				entries = append(entries, list...)
+			}
+
+			if formatFlag == formatJSON {
+				b, err := json.MarshalIndent(entries, "", "  ")
+				if err != nil {
+					return fmt.Errorf("[nrdeco] failed to encode the list: %w", err)
+				}
+				_, _ = fmt.Fprintln(cmd.OutOrStdout(), string(b))
+				return nil
+			}
+			w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 8, 2, ' ', 0)
+			_, _ = fmt.Fprintln(w, "FILE\tINTERFACE\tMETHOD\tINSTRUMENTED\tREASON\tSEGMENT")
+			for _, e := range entries {
+				instrumented := "no"
+				if e.Instrumented {
+					instrumented = "yes"
+				}
+				_, _ = fmt.Fprintf(
+					w,
+					"%s\t%s\t%s\t%s\t%s\t%s\n",
+					e.File,
+					e.Interface,
+					orDash(e.Method),
+					instrumented,
+					orDash(e.Reason),
+					orDash(e.Segment),
+				)
+			}
+			return w.Flush()
+		},
+	}
+	command.Flags().
+		StringVar(&formatFlag, "format", formatText, `A format of the list: text prints a table, and json prints a JSON array.`)
+	command.Flags().
+		StringVar(&configFlag, "config", "", `A configuration file. If not provided, nrdeco.yaml or .nrdeco.toml is searched for from the directory of each file up to the root.`)
+	return command
+}
+
+// orDash returns s, or "-" if s is empty.
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// sourceFiles returns the Go files given by args, each of which is a Go file or a package pattern.
+// The files of packages are relative to the current directory if possible.
+func sourceFiles(args []string) ([]string, error) {
+	if len(args) == 0 {
+		args = []string{"."}
+	}
+	var files, patterns []string
+	for _, arg := range args {
+		if strings.HasSuffix(arg, ".go") {
+			files = append(files, arg)
+			continue
+		}
+		patterns = append(patterns, arg)
+	}
+	if len(patterns) == 0 {
+		return files, nil
+	}
+	pkgs, err := internal.LoadPackages(patterns...)
+	if err != nil {
+		return nil, err
+	}
+	for _, pkg := range pkgs {
+		for _, file := range pkg.Files {
+			files = append(files, relativePath(file))
+		}
+	}
+	return files, nil
+}
+
+// relativePath returns path relative to the current directory if it is under the directory, otherwise path as is.
+func relativePath(path string) string {
+	wd, err := os.Getwd()
+	if err != nil {
+		return path
+	}
+	if rel, err := filepath.Rel(wd, path); err == nil && !strings.HasPrefix(rel, "..") {
+		return rel
+	}
+	return path
+}
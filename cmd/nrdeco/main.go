@@ -2,9 +2,14 @@ package main
 
 import (
 	"cmp"
+	"context"
+	"encoding/json"
 	"fmt"
+	"maps"
 	"os"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
 
 	"github.com/miyamo2/nrdeco/internal"
@@ -32,9 +37,26 @@ func main() {
 
 func rootCmd() (*cobra.Command, error) {
 	var (
-		sourceFlag  string
-		destFlag    string
-		versionFlag bool
+		sourceFlag      string
+		destFlag        string
+		typeFlag        []string
+		fromPackageFlag string
+		interfacesFlag  []string
+		checkFlag       bool
+		typeCheckFlag   bool
+		configFlag      string
+		destPackageFlag string
+		explicitFlag    bool
+		optionalFlag    []string
+		streamsFlag     bool
+		panicsFlag      bool
+		childCtxFlag    bool
+		prefixFlag      string
+		suffixFlag      string
+		typeNameFlag    string
+		formatFlag      string
+		manifestFlag    bool
+		versionFlag     bool
 	)
 	command := &cobra.Command{
 		Use:   "nrdeco",
@@ -45,42 +67,215 @@ func rootCmd() (*cobra.Command, error) {
 				cmd.Printf("[nrdeco] Version %s-%s\n", Version, Revision)
 				return nil
 			}
-			cmd.Printf("[nrdeco] input: %s", sourceFlag)
-			dest := cmp.Or(destFlag, strings.Replace(sourceFlag, ".go", ".nrdeco.go", -1))
-
-			b, err := internal.Generate(cmd.Context(), sourceFlag, dest, Version)
+			switch formatFlag {
+			case formatText, formatJSON:
+			default:
+				return fmt.Errorf(
+					"[nrdeco] unsupported format '%s': must be %s or %s",
+					formatFlag,
+					formatText,
+					formatJSON,
+				)
+			}
+			cfg, err := loadConfig(configFlag, cmp.Or(sourceFlag, destFlag, "."))
 			if err != nil {
-				return fmt.Errorf("[nrdeco] failed to generate code from %s: %w", sourceFlag, err)
+				cmd.SilenceUsage = true
+				return fmt.Errorf("[nrdeco] invalid configuration:\n%w", err)
 			}
 
-			destDir, _ := filepath.Split(dest)
-			fileInfo, _ := os.Lstat(filepath.Clean(destDir))
-			perm := os.ModePerm
-			if fileInfo != nil {
-				perm = fileInfo.Mode() & os.ModePerm
+			opts := []internal.Option{
+				internal.WithWarn(func(msg string) {
+					cmd.PrintErrf("[nrdeco] warning: %s\n", msg)
+				}),
+			}
+			opts = append(opts, segmentOptions(cfg)...)
+			if len(typeFlag) > 0 {
+				opts = append(opts, internal.WithTypes(typeFlag...))
+			}
+			if boolFlagOr(cmd, "explicit", explicitFlag, cfg != nil && cfg.Explicit) {
+				opts = append(opts, internal.WithExplicit())
+			}
+			if boolFlagOr(cmd, "streams", streamsFlag, cfg != nil && cfg.Streams) {
+				opts = append(opts, internal.WithStreams())
+			}
+			if boolFlagOr(cmd, "panics", panicsFlag, cfg != nil && cfg.Panics) {
+				opts = append(opts, internal.WithPanics())
+			}
+			if boolFlagOr(cmd, "child-context", childCtxFlag, cfg != nil && cfg.ChildContext) {
+				opts = append(opts, internal.WithChildContext())
+			}
+			optionals := make(map[string][]string)
+			if cfg != nil {
+				maps.Copy(optionals, cfg.Optionals)
+			}
+			for _, v := range optionalFlag {
+				name, list, ok := strings.Cut(v, "=")
+				if !ok || name == "" || list == "" {
+					return fmt.Errorf(
+						"[nrdeco] --optional must be in the form of <Interface>=<Optional>[,<Optional>...]: %s",
+						v,
+					)
+				}
+				optionals[name] = strings.Split(list, ",")
+			}
+			for name, list := range optionals {
+				opts = append(opts, internal.WithOptionals(name, list...))
+			}
+			prefixChanged := cmd.Flags().Changed("prefix")
+			suffixChanged := cmd.Flags().Changed("suffix")
+			switch {
+			case typeNameFlag != "":
+				opts = append(opts, internal.WithTypeNameTemplate(typeNameFlag))
+			case cfg != nil && cfg.TypeName != "" && !prefixChanged && !suffixChanged:
+				opts = append(opts, internal.WithTypeNameTemplate(cfg.TypeName))
+			default:
+				// Setting only one of the prefix and the suffix keeps the other from the file.
+				prefix, suffix := prefixFlag, suffixFlag
+				if cfg != nil && !prefixChanged {
+					prefix = cmp.Or(cfg.Prefix, internal.DefaultPrefix)
+				}
+				if cfg != nil && !suffixChanged {
+					suffix = cfg.Suffix
+				}
+				opts = append(opts, internal.WithPrefix(prefix), internal.WithSuffix(suffix))
+			}
+			if destPackageFlag != "" {
+				opts = append(opts, internal.WithDestPackage(destPackageFlag))
 			}
 
-			os.MkdirAll(destDir, perm)
-			f, err := os.Create(dest)
-			defer func() {
-				_ = f.Close()
-			}()
-			if err != nil {
-				return fmt.Errorf("[nrdeco] failed to create %s: %w", dest, err)
+			gen := goGenerateEnv()
+			source := sourceFlag
+			if source == "" && fromPackageFlag == "" && (cfg == nil || len(cfg.Packages) == 0) {
+				source = gen.file
 			}
-			_, err = f.Write(b)
-			if err != nil {
-				return fmt.Errorf("[nrdeco] failed to write to %s: %w", dest, err)
+
+			var tasks []task
+			switch {
+			case source != "":
+				var target string
+				if gen.file != "" && filepath.Clean(source) == gen.file {
+					opts = append(
+						opts,
+						internal.WithLine(gen.line),
+						internal.WithPackageName(gen.pkg),
+					)
+					target, err = internal.DirectiveTarget(source, gen.line)
+					if err != nil {
+						cmd.SilenceUsage = true
+						return report(
+							cmd,
+							formatFlag,
+							fmt.Sprintf("failed to parse %s", source),
+							err,
+						)
+					}
+				}
+				dest := destFlag
+				if dest == "" {
+					dest, err = defaultDest(source, target, cfg)
+					if err != nil {
+						return fmt.Errorf(
+							"[nrdeco] failed to resolve destination of %s: %w",
+							source,
+							err,
+						)
+					}
+				}
+				interfaces := interfacesFlag
+				if len(interfaces) == 0 && cfg != nil {
+					interfaces = cfg.Interfaces
+				}
+				tasks = append(tasks, task{
+					input:     source,
+					dest:      dest,
+					generate:  internal.Generate,
+					opts:      append(opts, internal.WithInterfaces(interfaces...)),
+					extracted: len(typeFlag) > 0,
+				})
+			case fromPackageFlag != "":
+				if destFlag == "" {
+					return fmt.Errorf("[nrdeco] --dest is required when --from-package is provided")
+				}
+				tasks = append(tasks, task{
+					input:       fromPackageFlag,
+					dest:        destFlag,
+					generate:    internal.GenerateFromPackage,
+					opts:        append(opts, internal.WithInterfaces(interfacesFlag...)),
+					fromPackage: true,
+				})
+			case cfg != nil && len(cfg.Packages) > 0:
+				for _, pkg := range cfg.Packages {
+					interfaces := internal.WithInterfaces(pkg.Interfaces...)
+					tasks = append(tasks, task{
+						input:       pkg.Path,
+						dest:        filepath.Join(cfg.Dir(), pkg.Dest),
+						generate:    internal.GenerateFromPackage,
+						opts:        append(slices.Clone(opts), interfaces),
+						fromPackage: true,
+					})
+				}
+			default:
+				return fmt.Errorf("[nrdeco] at least one of the flags in the group [source from-package version] is required")
+			}
+
+			manifest := boolFlagOr(cmd, "manifest", manifestFlag, cfg != nil && cfg.Manifest)
+			var stale []string
+			for _, t := range tasks {
+				t.manifest = manifest
+				outOfDate, err := t.run(cmd, checkFlag, typeCheckFlag, formatFlag)
+				if err != nil {
+					return err
+				}
+				if outOfDate {
+					stale = append(stale, t.dest)
+				}
+			}
+			if len(stale) > 0 {
+				cmd.SilenceUsage = true
+				return fmt.Errorf("[nrdeco] out of date:\n%s", strings.Join(stale, "\n"))
 			}
-			cmd.Printf("[nrdeco] wrote: %s\n", dest)
 			return nil
 		},
 	}
 	command.Flags().BoolVar(&versionFlag, "version", false, `Print the version of nrdeco.`)
 	command.Flags().
-		StringVarP(&sourceFlag, "source", "s", "", `A file containing interfaces to be decorate.`)
+		StringVarP(&sourceFlag, "source", "s", "", `A file containing interfaces to be decorate. If not provided when run by go generate, $GOFILE is used instead.`)
 	command.Flags().
 		StringVarP(&destFlag, "dest", "d", "", `A file to which the resulting source code will be written. If not provided, the code will be written to <source>.nrdeco.go instead.`)
+	command.Flags().
+		StringSliceVarP(&typeFlag, "type", "t", nil, `Struct types in the package of the source file from which interfaces are extracted and decorated. If provided, interfaces declared in the source file are ignored.`)
+	command.Flags().
+		StringVar(&fromPackageFlag, "from-package", "", `An import path of the package containing interfaces to be decorated. It is resolved from the module containing the destination.`)
+	command.Flags().
+		StringSliceVar(&interfacesFlag, "interfaces", nil, `Interfaces to be decorated. Required with --from-package. With --source, the other interfaces in the file are ignored.`)
+	command.Flags().
+		BoolVar(&checkFlag, "check", false, `Check that the destination is up to date without writing it. If it differs from the generated code, a unified diff is printed and nrdeco exits with a non-zero status.`)
+	command.Flags().
+		BoolVar(&typeCheckFlag, "typecheck", false, `Type-check the destination package with the generated code before writing it.`)
+	command.Flags().
+		StringVar(&destPackageFlag, "dest-package", "", `A package name of the resulting source code. If not provided, it is detected from the destination directory.`)
+	command.Flags().
+		BoolVar(&explicitFlag, "explicit", false, `Generate decorators that delegate every method explicitly to an unexported field instead of embedding the interface, with constructors rejecting nil.`)
+	command.Flags().
+		StringArrayVar(&optionalFlag, "optional", nil, `Optional interfaces retained by the decorator if the decorated value implements them, in the form of <Interface>=<Optional>[,<Optional>...]. Each optional interface is either <Name> in the package of the source or <import path>.<Name>.`)
+	command.Flags().
+		BoolVar(&streamsFlag, "streams", false, `Extend the segments of methods returning iterators (iter.Seq, iter.Seq2) or receive-only channels until the returned value is consumed or drained.`)
+	command.Flags().
+		BoolVar(&panicsFlag, "panics", false, `Recover panics in the decorated methods, notice them as errors with their stack traces, end the segments and re-panic.`)
+	command.Flags().
+		BoolVar(&childCtxFlag, "child-context", false, `Call the decorated methods with a child context carrying the segment. See nrdeco.FromContext.`)
+	command.Flags().
+		StringVar(&prefixFlag, "prefix", internal.DefaultPrefix, `A prefix of the decorator type names.`)
+	command.Flags().
+		StringVar(&suffixFlag, "suffix", "", `A suffix of the decorator type names.`)
+	command.Flags().
+		StringVar(&typeNameFlag, "type-name-template", "", `A template of the decorator type names, such as "{{ .Type }}Tracer". Available fields: .Package, .Type`)
+	command.Flags().
+		StringVar(&formatFlag, "format", formatText, `A format of the problems found while generating: text prints each as file:line:col: message, and json prints them as a JSON array to stdout.`)
+	command.Flags().
+		BoolVar(&manifestFlag, "manifest", false, `Record the generated file in `+internal.ManifestFileName+` at the root of the module, which nrdeco clean reads.`)
+	command.Flags().
+		StringVar(&configFlag, "config", "", `A configuration file. If not provided, nrdeco.yaml or .nrdeco.toml is searched for from the directory of the source up to the root.`)
 	err := command.MarkFlagFilename("source", "go")
 	if err != nil {
 		return nil, err
@@ -89,7 +284,216 @@ func rootCmd() (*cobra.Command, error) {
 	if err != nil {
 		return nil, err
 	}
-	command.MarkFlagsOneRequired("source", "version")
-	command.MarkFlagsMutuallyExclusive("source", "version")
+	err = command.MarkFlagFilename("config", "yaml", "yml", "toml")
+	if err != nil {
+		return nil, err
+	}
+	command.MarkFlagsMutuallyExclusive("source", "from-package", "version")
+	command.MarkFlagsMutuallyExclusive("from-package", "type")
+	command.MarkFlagsMutuallyExclusive("type-name-template", "prefix")
+	command.MarkFlagsMutuallyExclusive("type-name-template", "suffix")
+	command.MarkFlagsMutuallyExclusive("check", "version")
+	command.MarkFlagsMutuallyExclusive("typecheck", "version")
+	command.AddCommand(injectCmd(), stripCmd(), listCmd(), initCmd(), cleanCmd())
 	return command, nil
 }
+
+const (
+	formatText = "text"
+	formatJSON = "json"
+)
+
+// report prints the problems in err in format and returns the error to exit with.
+func report(cmd *cobra.Command, format, summary string, err error) error {
+	diagnostics := internal.Diagnostics(err)
+	if format == formatJSON {
+		b, jsonErr := json.MarshalIndent(diagnostics, "", "  ")
+		if jsonErr != nil {
+			return fmt.Errorf("[nrdeco] %s: %w", summary, err)
+		}
+		_, _ = fmt.Fprintln(cmd.OutOrStdout(), string(b))
+		return fmt.Errorf("[nrdeco] %s", summary)
+	}
+	lines := make([]string, 0, len(diagnostics))
+	for _, d := range diagnostics {
+		lines = append(lines, d.Error())
+	}
+	return fmt.Errorf("[nrdeco] %s:\n%s", summary, strings.Join(lines, "\n"))
+}
+
+// task represents a unit of generation.
+type task struct {
+	input    string
+	dest     string
+	generate func(
+		ctx context.Context,
+		input, dest, version string,
+		opts ...internal.Option,
+	) ([]byte, error)
+	opts []internal.Option
+	// fromPackage is true if input is an import path rather than a source file.
+	fromPackage bool
+	// extracted is true if the interfaces are extracted from struct types.
+	extracted bool
+	// manifest is true if the destination is recorded in the manifest.
+	manifest bool
+}
+
+// run generates the code of t and writes it to the destination.
+// If check is true, it compares the code with the destination instead
+// and reports whether the destination is out of date.
+func (t *task) run(cmd *cobra.Command, check, typeCheck bool, format string) (bool, error) {
+	cmd.Printf("[nrdeco] input: %s\n", t.input)
+	var types []string
+	opts := append(slices.Clone(t.opts), internal.WithDecorated(func(decorated []string) {
+		types = decorated
+	}))
+	b, err := t.generate(cmd.Context(), t.input, t.dest, Version, opts...)
+	if err != nil {
+		cmd.SilenceUsage = true
+		summary := fmt.Sprintf("failed to generate code from %s", t.input)
+		return false, report(cmd, format, summary, err)
+	}
+
+	if typeCheck {
+		if err := internal.TypeCheck(t.dest, b); err != nil {
+			cmd.SilenceUsage = true
+			summary := fmt.Sprintf("generated code for %s does not compile", t.dest)
+			return false, report(cmd, format, summary, err)
+		}
+	}
+
+	if check {
+		diff, err := internal.Diff(t.dest, b)
+		if err != nil {
+			return false, fmt.Errorf("[nrdeco] failed to check %s: %w", t.dest, err)
+		}
+		if diff != "" {
+			cmd.Print(diff)
+			return true, nil
+		}
+		cmd.Printf("[nrdeco] up to date: %s\n", t.dest)
+		return false, nil
+	}
+
+	written, err := internal.WriteFile(t.dest, b)
+	if err != nil {
+		return false, fmt.Errorf("[nrdeco] failed to write %s: %w", t.dest, err)
+	}
+	if written {
+		cmd.Printf("[nrdeco] wrote: %s\n", t.dest)
+	} else {
+		cmd.Printf("[nrdeco] unchanged: %s\n", t.dest)
+	}
+	if !t.manifest {
+		return false, nil
+	}
+	return false, t.record(types)
+}
+
+// record records the destination in the manifest of the module containing it, if any.
+func (t *task) record(types []string) error {
+	m, unlock, err := internal.LockManifest(filepath.Dir(t.dest))
+	if err != nil {
+		return fmt.Errorf("[nrdeco] failed to load the manifest: %w", err)
+	}
+	if m == nil {
+		return nil
+	}
+	defer unlock()
+	entry := internal.ManifestEntry{
+		Types:     types,
+		Extracted: t.extracted,
+	}
+	entry.Dest, err = m.Rel(t.dest)
+	if err != nil {
+		return fmt.Errorf("[nrdeco] %w", err)
+	}
+	if t.fromPackage {
+		entry.Package = t.input
+	} else {
+		entry.Source, err = m.Rel(t.input)
+		if err != nil {
+			return fmt.Errorf("[nrdeco] %w", err)
+		}
+	}
+	m.Record(entry)
+	if err := m.Save(); err != nil {
+		return fmt.Errorf("[nrdeco] failed to update the manifest: %w", err)
+	}
+	return nil
+}
+
+// defaultDest returns the destination of source if --dest is not provided.
+// If target is not empty, the destination is named after it,
+// so that the directives decorating the types in a file do not overwrite each other.
+func defaultDest(source, target string, cfg *internal.Config) (string, error) {
+	name := source
+	if target != "" {
+		name = fmt.Sprintf("%s_%s.go", strings.TrimSuffix(source, ".go"), strings.ToLower(target))
+	}
+	if cfg != nil && cfg.Output != "" {
+		return cfg.OutputPath(name)
+	}
+	return strings.Replace(name, ".go", ".nrdeco.go", -1), nil
+}
+
+// boolFlagOr returns the value of the bool flag name if it is set on the command line, or configured otherwise.
+func boolFlagOr(cmd *cobra.Command, name string, flag, configured bool) bool {
+	if cmd.Flags().Changed(name) {
+		return flag
+	}
+	return configured
+}
+
+// segmentOptions returns the options naming and skipping the segments as configured by cfg, which may be nil.
+func segmentOptions(cfg *internal.Config) []internal.Option {
+	var opts []internal.Option
+	if cfg == nil {
+		return opts
+	}
+	if cfg.Segment != "" {
+		opts = append(opts, internal.WithSegment(cfg.Segment))
+	}
+	if len(cfg.Methods) > 0 {
+		opts = append(opts, internal.WithMethods(cfg.Methods))
+	}
+	return opts
+}
+
+// goGenerate is the environment set by go generate for the file containing the directive.
+type goGenerate struct {
+	// file is $GOFILE, the base name of the file.
+	file string
+	// line is $GOLINE, the line of the directive.
+	line int
+	// pkg is $GOPACKAGE, the name of the package of the file.
+	pkg string
+}
+
+// goGenerateEnv returns the environment set by go generate, whose fields are zero if nrdeco is not run by it.
+func goGenerateEnv() goGenerate {
+	line, _ := strconv.Atoi(os.Getenv("GOLINE"))
+	return goGenerate{
+		file: os.Getenv("GOFILE"),
+		line: line,
+		pkg:  os.Getenv("GOPACKAGE"),
+	}
+}
+
+// loadConfig loads the configuration file at path,
+// or the one found by walking up from the directory of file if path is empty.
+// It returns nil if there is no configuration file.
+func loadConfig(path, file string) (*internal.Config, error) {
+	if path == "" {
+		var err error
+		path, err = internal.FindConfig(filepath.Dir(file))
+		if err != nil {
+			return nil, err
+		}
+		if path == "" {
+			return nil, nil
+		}
+	}
+	return internal.LoadConfig(path)
+}
@@ -3,13 +3,16 @@ module github.com/miyamo2/nrdeco
 go 1.24
 
 require (
+	github.com/BurntSushi/toml v1.6.0
+	github.com/pmezard/go-difflib v1.0.0
 	github.com/spf13/cobra v1.9.1
+	golang.org/x/mod v0.25.0
 	golang.org/x/tools v0.34.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
 	github.com/inconshreveable/mousetrap v1.1.0 // indirect
 	github.com/spf13/pflag v1.0.6 // indirect
-	golang.org/x/mod v0.25.0 // indirect
 	golang.org/x/sync v0.15.0 // indirect
 )
@@ -0,0 +1,41 @@
+package internal
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+// Diff returns a unified diff between the existing content of dest and generated.
+// It returns an empty string if they are identical byte-for-byte.
+func Diff(dest string, generated []byte) (string, error) {
+	current, err := os.ReadFile(dest)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return "", fmt.Errorf("failed to read %s: %w", dest, err)
+	}
+	if bytes.Equal(current, generated) {
+		return "", nil
+	}
+	diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        splitLines(current),
+		B:        splitLines(generated),
+		FromFile: fmt.Sprintf("a/%s", dest),
+		ToFile:   fmt.Sprintf("b/%s", dest),
+		Context:  3,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to compute diff of %s: %w", dest, err)
+	}
+	return diff, nil
+}
+
+func splitLines(b []byte) []string {
+	if len(b) == 0 {
+		return nil
+	}
+	return difflib.SplitLines(string(b))
+}
@@ -0,0 +1,425 @@
+package internal
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// configFileNames are the names of the configuration files, in order of precedence.
+var configFileNames = []string{
+	"nrdeco.yaml",
+	"nrdeco.yml",
+	".nrdeco.yaml",
+	".nrdeco.yml",
+	"nrdeco.toml",
+	".nrdeco.toml",
+}
+
+const (
+	// BackendNewRelic is the backend which instruments with New Relic APM segments.
+	BackendNewRelic = "newrelic"
+)
+
+// Config represents the project-level configuration of nrdeco.
+type Config struct {
+	// Path is the path of the configuration file.
+	Path string `yaml:"-" toml:"-"`
+	// Backend is the instrumentation backend.
+	Backend string `yaml:"backend" toml:"backend"`
+	// Segment is the template of the segment names.
+	Segment string `yaml:"segment" toml:"segment"`
+	// Prefix is the prefix of the decorator type names.
+	Prefix string `yaml:"prefix" toml:"prefix"`
+	// Suffix is the suffix of the decorator type names.
+	Suffix string `yaml:"suffix" toml:"suffix"`
+	// TypeName is the template of the decorator type names, overriding Prefix and Suffix.
+	TypeName string `yaml:"typeName" toml:"typeName"`
+	// Output is the template of the destination used if it is not provided.
+	Output string `yaml:"output" toml:"output"`
+	// Explicit makes the decorators delegate every method explicitly.
+	Explicit bool `yaml:"explicit" toml:"explicit"`
+	// Streams extends the segments of methods returning iterators or receive-only channels.
+	Streams bool `yaml:"streams" toml:"streams"`
+	// Panics notices panics in the decorated methods as errors.
+	Panics bool `yaml:"panics" toml:"panics"`
+	// ChildContext calls the decorated methods with a child context carrying the segment.
+	ChildContext bool `yaml:"childContext" toml:"childContext"`
+	// Manifest records the generated files in the manifest at the root of the module.
+	Manifest bool `yaml:"manifest" toml:"manifest"`
+	// Interfaces limits the interfaces to be decorated.
+	Interfaces []string `yaml:"interfaces" toml:"interfaces"`
+	// Optionals are the optional interfaces retained by the decorators, keyed by the decorated interface.
+	Optionals map[string][]string `yaml:"optionals" toml:"optionals"`
+	// Packages are the packages to be decorated if neither a source nor a package is provided.
+	Packages []PackageConfig `yaml:"packages" toml:"packages"`
+	// Methods overrides the behavior per method, keyed by "<Interface>.<Method>".
+	Methods map[string]MethodConfig `yaml:"methods" toml:"methods"`
+}
+
+// PackageConfig represents a package to be decorated.
+type PackageConfig struct {
+	// Path is the import path of the package.
+	Path string `yaml:"path" toml:"path"`
+	// Interfaces are the interfaces in the package to be decorated.
+	Interfaces []string `yaml:"interfaces" toml:"interfaces"`
+	// Dest is the file to which the generated code is written, relative to the configuration file.
+	Dest string `yaml:"dest" toml:"dest"`
+}
+
+// MethodConfig overrides the behavior of a method.
+type MethodConfig struct {
+	// Skip excludes the method from instrumentation.
+	Skip bool `yaml:"skip" toml:"skip"`
+	// Segment is the template of the segment name of the method.
+	Segment string `yaml:"segment" toml:"segment"`
+	// Async is the same as the //nrdeco:async directive on the method.
+	Async bool `yaml:"async" toml:"async"`
+}
+
+// ConfigError represents an error in a configuration file.
+type ConfigError struct {
+	Path    string
+	Line    int
+	Message string
+}
+
+// Error implements error.
+func (e *ConfigError) Error() string {
+	if e.Line == 0 {
+		return fmt.Sprintf("%s: %s", e.Path, e.Message)
+	}
+	return fmt.Sprintf("%s:%d: %s", e.Path, e.Line, e.Message)
+}
+
+// FindConfig walks up from dir and returns the path of the first configuration file found.
+// It returns an empty string if there is no configuration file.
+func FindConfig(dir string) (string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", fmt.Errorf("failed to get absolute path of %s: %w", dir, err)
+	}
+	for {
+		for _, name := range configFileNames {
+			p := filepath.Join(dir, name)
+			_, err := os.Stat(p)
+			if err == nil {
+				return p, nil
+			}
+			if !errors.Is(err, fs.ErrNotExist) {
+				return "", fmt.Errorf("failed to stat %s: %w", p, err)
+			}
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", nil
+		}
+		dir = parent
+	}
+}
+
+// LoadConfig loads the configuration file at path.
+// Errors in the file are reported as *ConfigError with their line numbers.
+func LoadConfig(path string) (*Config, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	var (
+		cfg *Config
+		loc locator
+	)
+	switch filepath.Ext(path) {
+	case ".toml":
+		cfg, loc, err = decodeTOML(path, b)
+	default:
+		cfg, loc, err = decodeYAML(path, b)
+	}
+	if err != nil {
+		return nil, err
+	}
+	cfg.Path = path
+
+	var errs []error
+	for _, issue := range cfg.validate() {
+		errs = append(errs, &ConfigError{
+			Path:    path,
+			Line:    loc.line(issue.key...),
+			Message: issue.message,
+		})
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return cfg, nil
+}
+
+// Dir returns the directory containing the configuration file.
+func (c *Config) Dir() string {
+	return filepath.Dir(c.Path)
+}
+
+// OutputPath returns the destination for source according to the output template.
+func (c *Config) OutputPath(source string) (string, error) {
+	tpl, err := template.New("output").Parse(c.Output)
+	if err != nil {
+		return "", err
+	}
+	dir, file := filepath.Split(source)
+	var buf bytes.Buffer
+	err = tpl.Execute(&buf, struct {
+		Dir  string
+		Name string
+	}{
+		Dir:  filepath.Clean(dir),
+		Name: strings.TrimSuffix(file, ".go"),
+	})
+	if err != nil {
+		return "", err
+	}
+	return filepath.Clean(buf.String()), nil
+}
+
+// configIssue represents a semantic error in a configuration, identified by its key path.
+type configIssue struct {
+	key     []string
+	message string
+}
+
+func (c *Config) validate() []configIssue {
+	var issues []configIssue
+	switch c.Backend {
+	case "", BackendNewRelic:
+	default:
+		issues = append(issues, configIssue{
+			key:     []string{"backend"},
+			message: fmt.Sprintf("unsupported backend '%s'", c.Backend),
+		})
+	}
+	if c.Segment != "" {
+		if _, err := parseSegmentTemplate(c.Segment); err != nil {
+			issues = append(issues, configIssue{
+				key:     []string{"segment"},
+				message: fmt.Sprintf("invalid segment template: %v", err),
+			})
+		}
+	}
+	if c.TypeName != "" {
+		if _, err := parseTypeNameTemplate(c.TypeName); err != nil {
+			issues = append(issues, configIssue{
+				key:     []string{"typeName"},
+				message: fmt.Sprintf("invalid type name template: %v", err),
+			})
+		}
+		if c.Prefix != "" || c.Suffix != "" {
+			issues = append(issues, configIssue{
+				key:     []string{"typeName"},
+				message: "typeName cannot be used with prefix or suffix",
+			})
+		}
+	}
+	if c.Output != "" {
+		if _, err := template.New("output").Parse(c.Output); err != nil {
+			issues = append(issues, configIssue{
+				key:     []string{"output"},
+				message: fmt.Sprintf("invalid output template: %v", err),
+			})
+		}
+	}
+	for i, pkg := range c.Packages {
+		key := []string{"packages", strconv.Itoa(i)}
+		if pkg.Path == "" {
+			issues = append(issues, configIssue{
+				key:     key,
+				message: "path is required",
+			})
+		}
+		if len(pkg.Interfaces) == 0 {
+			issues = append(issues, configIssue{
+				key:     key,
+				message: "interfaces is required",
+			})
+		}
+		if pkg.Dest == "" {
+			issues = append(issues, configIssue{
+				key:     key,
+				message: "dest is required",
+			})
+		}
+	}
+	for _, name := range slices.Sorted(maps.Keys(c.Methods)) {
+		key := []string{"methods", name}
+		if typ, method, ok := strings.Cut(name, "."); !ok || typ == "" || method == "" {
+			issues = append(issues, configIssue{
+				key: key,
+				message: fmt.Sprintf(
+					"method '%s' must be in the form of '<Interface>.<Method>'",
+					name,
+				),
+			})
+		}
+		if segment := c.Methods[name].Segment; segment != "" {
+			if _, err := parseSegmentTemplate(segment); err != nil {
+				issues = append(issues, configIssue{
+					key:     append(key, "segment"),
+					message: fmt.Sprintf("invalid segment template: %v", err),
+				})
+			}
+		}
+	}
+	return issues
+}
+
+// locator finds the line of a key in a configuration file.
+type locator interface {
+	line(key ...string) int
+}
+
+var yamlErrorLine = regexp.MustCompile(`line (\d+): (.*)`)
+
+func decodeYAML(path string, b []byte) (*Config, locator, error) {
+	var root yaml.Node
+	if err := yaml.Unmarshal(b, &root); err != nil {
+		return nil, nil, yamlError(path, err)
+	}
+	cfg := &Config{}
+	dec := yaml.NewDecoder(bytes.NewReader(b))
+	dec.KnownFields(true)
+	if err := dec.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+		return nil, nil, yamlError(path, err)
+	}
+	return cfg, &yamlLocator{root: &root}, nil
+}
+
+func yamlError(path string, err error) error {
+	messages := []string{err.Error()}
+	if typeErr, ok := err.(*yaml.TypeError); ok {
+		messages = typeErr.Errors
+	}
+	errs := make([]error, 0, len(messages))
+	for _, message := range messages {
+		configErr := &ConfigError{
+			Path:    path,
+			Message: strings.TrimPrefix(message, "yaml: "),
+		}
+		if m := yamlErrorLine.FindStringSubmatch(message); m != nil {
+			configErr.Line, _ = strconv.Atoi(m[1])
+			configErr.Message = m[2]
+		}
+		errs = append(errs, configErr)
+	}
+	return errors.Join(errs...)
+}
+
+type yamlLocator struct {
+	root *yaml.Node
+}
+
+func (l *yamlLocator) line(key ...string) int {
+	node := l.root
+	if node.Kind == yaml.DocumentNode && len(node.Content) > 0 {
+		node = node.Content[0]
+	}
+	line := node.Line
+	for _, k := range key {
+		var next *yaml.Node
+		switch node.Kind {
+		case yaml.MappingNode:
+			for i := 0; i+1 < len(node.Content); i += 2 {
+				if node.Content[i].Value == k {
+					line = node.Content[i].Line
+					next = node.Content[i+1]
+					break
+				}
+			}
+		case yaml.SequenceNode:
+			if i, err := strconv.Atoi(k); err == nil && i < len(node.Content) {
+				next = node.Content[i]
+				line = next.Line
+			}
+		}
+		if next == nil {
+			break
+		}
+		node = next
+	}
+	return line
+}
+
+func decodeTOML(path string, b []byte) (*Config, locator, error) {
+	cfg := &Config{}
+	md, err := toml.Decode(string(b), cfg)
+	if err != nil {
+		var parseErr toml.ParseError
+		if errors.As(err, &parseErr) {
+			return nil, nil, &ConfigError{
+				Path:    path,
+				Line:    parseErr.Position.Line,
+				Message: parseErr.Message,
+			}
+		}
+		return nil, nil, &ConfigError{
+			Path:    path,
+			Message: err.Error(),
+		}
+	}
+	loc := &tomlLocator{lines: strings.Split(string(b), "\n")}
+	if undecoded := md.Undecoded(); len(undecoded) > 0 {
+		errs := make([]error, 0, len(undecoded))
+		for _, key := range undecoded {
+			errs = append(errs, &ConfigError{
+				Path:    path,
+				Line:    loc.line(key...),
+				Message: fmt.Sprintf("field %s not found in type internal.Config", key.String()),
+			})
+		}
+		return nil, nil, errors.Join(errs...)
+	}
+	return cfg, loc, nil
+}
+
+// tomlLocator finds the line of a key by scanning the lines of a TOML file,
+// since the TOML decoder does not expose the positions of keys.
+type tomlLocator struct {
+	lines []string
+}
+
+func (l *tomlLocator) line(key ...string) int {
+	var name string
+	for _, k := range slices.Backward(key) {
+		if _, err := strconv.Atoi(k); err != nil {
+			name = k
+			break
+		}
+	}
+	if name == "" {
+		return 0
+	}
+	quoted := strconv.Quote(name)
+	for i, line := range l.lines {
+		line = strings.TrimSpace(line)
+		for _, k := range []string{name, quoted} {
+			rest, ok := strings.CutPrefix(line, k)
+			if strings.HasPrefix(line, fmt.Sprintf("[%s]", k)) ||
+				strings.HasPrefix(line, fmt.Sprintf("[[%s]]", k)) ||
+				strings.HasSuffix(line, fmt.Sprintf(".%s]", k)) ||
+				ok && strings.HasPrefix(strings.TrimSpace(rest), "=") {
+				return i + 1
+			}
+		}
+	}
+	return 0
+}
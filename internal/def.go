@@ -17,12 +17,25 @@ type File struct {
 	Interfaces          []Interface
 	// DifferInDest indicates if the file to be generated in a different destination than the original file.
 	DifferInDest bool
+	// Explicit indicates if the decorators delegate every method explicitly to an unexported field
+	// instead of embedding the interface.
+	Explicit bool
+	// Streams indicates if the segments of methods returning streams last until the streams are consumed.
+	Streams bool
+	// Panics indicates if panics in the decorated methods are noticed as errors before they are re-panicked.
+	Panics bool
+	// ChildContext indicates if the decorated methods are called with a child context carrying the segment.
+	ChildContext bool
 }
 
 // StringOfImports returns a string representation of the imports in the file, sorted by package path
 func (f *File) StringOfImports() string {
 	v := make([]string, 0, len(f.Imports))
 	for _, k := range slices.Sorted(maps.Keys(f.Imports)) {
+		if p := f.Imports[k].Path; importName(p) != k {
+			v = append(v, fmt.Sprintf("\t%s \"%s\"", k, p))
+			continue
+		}
 		v = append(v, fmt.Sprintf("\t\"%s\"", f.Imports[k].Path))
 	}
 	return strings.Join(v, "\n")
@@ -37,10 +50,98 @@ func (f *File) InterfaceNameWithPackage(name string) string {
 	return fmt.Sprintf("%s.%s", f.OriginalPackageName, name)
 }
 
+// InterfaceType returns the type expression of the interface t in the generated file.
+func (f *File) InterfaceType(t Interface) string {
+	if t.Extracted() {
+		return t.Name
+	}
+	return f.InterfaceNameWithPackage(t.Name)
+}
+
+// Field returns the name of the field of the decorator holding the decorated value of t.
+func (f *File) Field(t Interface) string {
+	if f.Explicit {
+		return "inner"
+	}
+	return t.Name
+}
+
+// Targets returns the names of the decorated types in f.
+func (f *File) Targets() []string {
+	targets := make([]string, 0, len(f.Interfaces))
+	for _, t := range f.Interfaces {
+		targets = append(targets, t.Target())
+	}
+	return targets
+}
+
+// Call represents a call of a decorated method or function in the generated code.
+type Call struct {
+	File   *File
+	Method *Method
+	// Callee is the expression of the decorated method or function, such as "n.Store.Get".
+	Callee string
+}
+
+// Call returns the Call of method m of t.
+func (f *File) Call(t Interface, m Method) Call {
+	callee := fmt.Sprintf("n.%s.%s", f.Field(t), m.Name)
+	if t.Function {
+		callee = "h"
+	}
+	return Call{
+		File:   f,
+		Method: &m,
+		Callee: callee,
+	}
+}
+
 // Interface represents a type
 type Interface struct {
 	Name    string
 	Methods []Method
+	// Struct is the name of the struct type from which the interface is extracted.
+	// It is empty if the interface is declared in the source file.
+	Struct string
+	// Declared holds all methods of the interface, including those not to be instrumented.
+	// Methods of embedded interfaces are included only if the interface is loaded with type information.
+	Declared []Method
+	// Optionals are the optional interfaces retained by the decorator if the decorated value implements them.
+	Optionals []Value
+	// DecoratorName is the name of the generated decorator type, or the decorating function of a function type.
+	DecoratorName string
+	// Function indicates if the type is a function type rather than an interface.
+	// Its only method is named after the type and stands for the call of the function.
+	Function bool
+}
+
+// HasMethod returns true if the interface declares a method named name, otherwise false.
+func (i *Interface) HasMethod(name string) bool {
+	return slices.ContainsFunc(i.Declared, func(m Method) bool {
+		return m.Name == name
+	})
+}
+
+// Delegated returns the declared methods which are not instrumented.
+func (i *Interface) Delegated() []Method {
+	return slices.DeleteFunc(slices.Clone(i.Declared), func(m Method) bool {
+		return slices.ContainsFunc(i.Methods, func(instrumented Method) bool {
+			return instrumented.Name == m.Name
+		})
+	})
+}
+
+// Extracted returns true if the interface is extracted from a struct type, otherwise false.
+func (i *Interface) Extracted() bool {
+	return i.Struct != ""
+}
+
+// Target returns the name of the type that the segments are named after.
+func (i *Interface) Target() string {
+	if i.Extracted() {
+		return i.Struct
+	}
+	return i.Name
 }
 
 // Method represents a method
@@ -48,23 +149,60 @@ type Method struct {
 	Name    string
 	Params  Params
 	Returns Returns
+	// Segment is the name of the segment started by the method.
+	Segment string
+	// Async indicates if the decorated method is called with a goroutine-safe transaction on ctx,
+	// since its implementation uses the transaction from other goroutines.
+	Async bool
 }
 
 type Imports []Package
 
 // Signature returns the method signature in the format "MethodName(ctx context.Context, arg1 Arg1Type, arg2 Arg2Type) (_ Return0Type, _ Return1Type)".
 func (m *Method) Signature() string {
+	return fmt.Sprintf("%s(%s)%s", m.Name, m.Params.Signature(), m.Results())
+}
+
+// Results returns the unnamed results of the method in the format " Return0Type" or " (Return0Type, Return1Type)",
+// or an empty string if there is none.
+func (m *Method) Results() string {
 	if len(m.Returns) == 0 {
-		return fmt.Sprintf("%s(%s)", m.Name, m.Params.Signature())
+		return ""
 	}
 	if len(m.Returns) == 1 {
-		return fmt.Sprintf("%s(%s) %s", m.Name, m.Params.Signature(), m.Returns[0].StringOfType())
+		return fmt.Sprintf(" %s", m.Returns[0].StringOfType())
 	}
 	rets := make([]string, 0, len(m.Returns))
 	for _, ret := range m.Returns {
 		rets = append(rets, ret.StringOfType())
 	}
-	return fmt.Sprintf("%s(%s) (%s)", m.Name, m.Params.Signature(), strings.Join(rets, ", "))
+	return fmt.Sprintf(" (%s)", strings.Join(rets, ", "))
+}
+
+// StreamIndex returns the index of the first return value which is a stream, or -1 if there is none.
+func (m *Method) StreamIndex() int {
+	return slices.IndexFunc(m.Returns, func(ret Value) bool {
+		return ret.IsStream()
+	})
+}
+
+// Stream returns the first return value which is a stream.
+func (m *Method) Stream() *Value {
+	return &m.Returns[m.StreamIndex()]
+}
+
+// StreamName returns the name of the first return value which is a stream.
+func (m *Method) StreamName() string {
+	return fmt.Sprintf("ret%d", m.StreamIndex())
+}
+
+// ResultNames returns the names of the return values in the format "ret0, ret1".
+func (m *Method) ResultNames() string {
+	v := make([]string, 0, len(m.Returns))
+	for i := range m.Returns {
+		v = append(v, fmt.Sprintf("ret%d", i))
+	}
+	return strings.Join(v, ", ")
 }
 
 // Params represents the method parameters
@@ -112,60 +250,162 @@ func (p *Params) BeGenerated() bool {
 	}) >= 0
 }
 
+// Declaration returns the parameters of a function type as declared, in the format "a int, b string" or "int, string".
+func (p *Params) Declaration() string {
+	v := make([]string, 0, len(*p))
+	for _, param := range *p {
+		v = append(v, param.declaration())
+	}
+	return strings.Join(v, ", ")
+}
+
 // Returns represents the method return values
 type Returns []Value
 
+// Declaration returns the results of a function type as declared,
+// in the format " int", " (int, error)" or " (n int, err error)", or an empty string if there is none.
+func (r *Returns) Declaration() string {
+	if len(*r) == 0 {
+		return ""
+	}
+	if len(*r) == 1 && (*r)[0].Name == "" {
+		return fmt.Sprintf(" %s", (*r)[0].StringOfType())
+	}
+	v := make([]string, 0, len(*r))
+	for _, ret := range *r {
+		v = append(v, ret.declaration())
+	}
+	return fmt.Sprintf(" (%s)", strings.Join(v, ", "))
+}
+
 const (
 	typePointer        = "*"
 	typeSlice          = "[]"
+	typeArray          = "[n]"
 	typeMap            = "map"
 	typeChannel        = "chan"
 	typeChannelReceive = "<-chan"
 	typeChannelSend    = "chan<-"
 	typeFunction       = "func"
+	typeStruct         = "struct"
+	typeInterface      = "interface"
 	typeVariadic       = "..."
 	typeContext        = "Context"
 )
 
 // Value represents a parameter or return value.
 type Value struct {
+	// Name is the name of the parameter or the result in a function type, or empty if it is unnamed.
+	Name    string
 	Package *Package
 	Type    string
-	Key     string
+	// Len is the length of an array type as written in the source.
+	Len     string
+	Key     *Value
 	Element *Value
 	Params  Params
 	Returns Returns
+	// Fields are the fields of an anonymous struct type, or the methods and the embedded types of an anonymous interface type.
+	// Embedded fields and types are unnamed.
+	Fields []Value
+	// Tag is the tag of a struct field as written in the source, or empty if it has none.
+	Tag string
+	// TypeArgs are the type arguments of an instantiated generic type.
+	TypeArgs []Value
 }
 
 // StringOfType returns the string representation of the value's type
 func (v *Value) StringOfType() string {
 	switch v.Type {
-	case typeSlice, typePointer, typeVariadic, typeChannel:
+	case typeSlice, typePointer, typeVariadic:
 		return fmt.Sprintf("%s%s", v.Type, v.Element.StringOfType())
+	case typeArray:
+		return fmt.Sprintf("[%s]%s", v.Len, v.Element.StringOfType())
+	case typeChannel:
+		if v.Element.Type == typeChannelReceive {
+			// chan (<-chan T) differs from chan<- (chan T).
+			return fmt.Sprintf("%s (%s)", v.Type, v.Element.StringOfType())
+		}
+		return fmt.Sprintf("%s %s", v.Type, v.Element.StringOfType())
 	case typeChannelReceive, typeChannelSend:
 		return fmt.Sprintf("%s %s", v.Type, v.Element.StringOfType())
 	case typeMap:
-		return fmt.Sprintf("map[%s]%s", v.Key, v.Element.StringOfType())
+		return fmt.Sprintf("map[%s]%s", v.Key.StringOfType(), v.Element.StringOfType())
 	case typeFunction:
-		if len(v.Returns) == 0 {
-			return fmt.Sprintf("func(%s)", v.Params.Signature())
-		}
-		if len(v.Returns) == 1 {
-			return fmt.Sprintf("func(%s) %s", v.Params.Signature(), v.Returns[0].StringOfType())
+		return fmt.Sprintf("func(%s)%s", v.Params.Declaration(), v.Returns.Declaration())
+	case typeStruct, typeInterface:
+		if len(v.Fields) == 0 {
+			return fmt.Sprintf("%s{}", v.Type)
 		}
-		rets := make([]string, 0, len(v.Returns))
-		for _, ret := range v.Returns {
-			rets = append(rets, ret.StringOfType())
+		fields := make([]string, 0, len(v.Fields))
+		for _, field := range v.Fields {
+			switch {
+			case v.Type == typeInterface && field.Name != "":
+				fields = append(fields, fmt.Sprintf(
+					"%s(%s)%s",
+					field.Name,
+					field.Params.Declaration(),
+					field.Returns.Declaration(),
+				))
+			case field.Tag != "":
+				fields = append(fields, fmt.Sprintf("%s %s", field.declaration(), field.Tag))
+			default:
+				fields = append(fields, field.declaration())
+			}
 		}
-		return fmt.Sprintf("func(%s) (%s)", v.Params.Signature(), strings.Join(rets, ", "))
+		return fmt.Sprintf("%s{ %s }", v.Type, strings.Join(fields, "; "))
 	}
-	if v.Package != nil {
+	name := v.Type
+	if v.Package != nil && v.Package.Name != "" {
+		name = fmt.Sprintf("%s.%s", v.Package.Name, v.Type)
+	} else if v.Package != nil {
 		if parts := strings.Split(v.Package.Path, "/"); len(parts) > 1 {
-			return fmt.Sprintf("%s.%s", parts[len(parts)-1], v.Type)
+			name = fmt.Sprintf("%s.%s", parts[len(parts)-1], v.Type)
+		} else {
+			name = fmt.Sprintf("%s.%s", v.Package.Path, v.Type)
+		}
+	}
+	if len(v.TypeArgs) > 0 {
+		args := make([]string, 0, len(v.TypeArgs))
+		for _, arg := range v.TypeArgs {
+			args = append(args, arg.StringOfType())
 		}
-		return fmt.Sprintf("%s.%s", v.Package.Path, v.Type)
+		name = fmt.Sprintf("%s[%s]", name, strings.Join(args, ", "))
+	}
+	return name
+}
+
+// declaration returns the value as a parameter or a result of a function type, prefixed with its name if it is named.
+func (v *Value) declaration() string {
+	if v.Name == "" {
+		return v.StringOfType()
+	}
+	return fmt.Sprintf("%s %s", v.Name, v.StringOfType())
+}
+
+// IsIterator returns true if the value is an iter.Seq or iter.Seq2 type, otherwise false.
+func (v *Value) IsIterator() bool {
+	return v.Package != nil && v.Package.Path == "iter" && (v.Type == "Seq" || v.Type == "Seq2")
+}
+
+// IsReceiveChannel returns true if the value is a receive-only channel type, otherwise false.
+func (v *Value) IsReceiveChannel() bool {
+	return v.Type == typeChannelReceive
+}
+
+// IsStream returns true if the value is consumed after it is returned,
+// i.e. an iterator or a receive-only channel, otherwise false.
+func (v *Value) IsStream() bool {
+	return v.IsIterator() || v.IsReceiveChannel()
+}
+
+// YieldType returns the type of the yield function of the iterator.
+func (v *Value) YieldType() string {
+	args := make([]string, 0, len(v.TypeArgs))
+	for _, arg := range v.TypeArgs {
+		args = append(args, arg.StringOfType())
 	}
-	return v.Type
+	return fmt.Sprintf("func(%s) bool", strings.Join(args, ", "))
 }
 
 // IsContext return true if the value is a context.Context type, otherwise false.
@@ -176,4 +416,6 @@ func (v *Value) IsContext() bool {
 // Package represents a Go package.
 type Package struct {
 	Path string
+	// Name is the name by which the package is referred to, or empty to derive it from Path.
+	Name string
 }
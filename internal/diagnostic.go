@@ -0,0 +1,128 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/token"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// Diagnostic represents a problem found at a position in the source.
+type Diagnostic struct {
+	Pos     token.Position
+	Message string
+}
+
+// Error implements error.
+func (d *Diagnostic) Error() string {
+	if d.Pos.Filename == "" && !d.Pos.IsValid() {
+		return d.Message
+	}
+	return fmt.Sprintf("%s: %s", d.Pos, d.Message)
+}
+
+// MarshalJSON implements json.Marshaler.
+func (d *Diagnostic) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		File    string `json:"file,omitempty"`
+		Line    int    `json:"line,omitempty"`
+		Column  int    `json:"column,omitempty"`
+		Message string `json:"message"`
+	}{
+		File:    d.Pos.Filename,
+		Line:    d.Pos.Line,
+		Column:  d.Pos.Column,
+		Message: d.Message,
+	})
+}
+
+// positionOf returns the position of pos in fset, whose file name is converted by displayPath.
+func positionOf(fset *token.FileSet, pos token.Pos) token.Position {
+	position := fset.Position(pos)
+	position.Filename = displayPath(position.Filename)
+	return position
+}
+
+// displayPath returns path relative to the working directory if it is inside it, or the absolute path otherwise,
+// so that the Diagnostics refer to files alike whether they are given or loaded.
+func displayPath(path string) string {
+	if path == "" {
+		return path
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		return abs
+	}
+	if rel, err := filepath.Rel(wd, abs); err == nil && !strings.HasPrefix(rel, "..") {
+		return rel
+	}
+	return abs
+}
+
+// Diagnostics returns every problem in err, which may wrap or join several errors.
+// An error wrapping positioned problems is replaced with them,
+// and the other errors are returned as Diagnostics with their messages only.
+func Diagnostics(err error) []*Diagnostic {
+	switch e := err.(type) {
+	case nil:
+		return nil
+	case *Diagnostic:
+		return []*Diagnostic{e}
+	case interface{ Unwrap() []error }:
+		var diagnostics []*Diagnostic
+		for _, inner := range e.Unwrap() {
+			diagnostics = append(diagnostics, Diagnostics(inner)...)
+		}
+		return diagnostics
+	case interface{ Unwrap() error }:
+		inner := Diagnostics(e.Unwrap())
+		if slices.ContainsFunc(inner, func(d *Diagnostic) bool {
+			return d.Pos.IsValid()
+		}) {
+			return inner
+		}
+	}
+	return []*Diagnostic{{Message: err.Error()}}
+}
+
+// diagnosticFromPackageError returns the Diagnostic of an error reported while loading a package,
+// whose position is in the form of "file:line:col", "file:line", "file" or empty.
+func diagnosticFromPackageError(err packages.Error) *Diagnostic {
+	pos := err.Pos
+	var nums []int
+	for range 2 {
+		i := strings.LastIndex(pos, ":")
+		if i == -1 {
+			break
+		}
+		n, convErr := strconv.Atoi(pos[i+1:])
+		if convErr != nil {
+			break
+		}
+		nums = slices.Insert(nums, 0, n)
+		pos = pos[:i]
+	}
+	d := &Diagnostic{
+		Pos: token.Position{
+			Filename: displayPath(pos),
+		},
+		Message: err.Msg,
+	}
+	if len(nums) > 0 {
+		d.Pos.Line = nums[0]
+	}
+	if len(nums) > 1 {
+		d.Pos.Column = nums[1]
+	}
+	return d
+}
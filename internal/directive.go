@@ -0,0 +1,78 @@
+package internal
+
+import (
+	"go/ast"
+	"go/token"
+	"strings"
+)
+
+// directiveAsync marks a method whose implementation uses the transaction from other goroutines.
+const directiveAsync = "nrdeco:async"
+
+// directiveInject marks a statement inserted by Inject.
+const directiveInject = "nrdeco:inject"
+
+// hasDirective returns true if doc contains the directive "//<name>", otherwise false.
+func hasDirective(doc *ast.CommentGroup, name string) bool {
+	if doc == nil {
+		return false
+	}
+	for _, c := range doc.List {
+		text, ok := strings.CutPrefix(c.Text, "//")
+		if !ok {
+			continue
+		}
+		// A directive has no space after the slashes, unlike a comment mentioning it.
+		if strings.HasPrefix(text, " ") {
+			continue
+		}
+		if fields := strings.Fields(text); len(fields) > 0 && fields[0] == name {
+			return true
+		}
+	}
+	return false
+}
+
+// DirectiveTarget returns the name of the interface or function type decorated by the directive at line of file,
+// or empty if the directive decorates every interface in the file.
+func DirectiveTarget(file string, line int) (string, error) {
+	fset := token.NewFileSet()
+	node, err := parseFile(fset, file, nil)
+	if err != nil {
+		return "", err
+	}
+	return typeBelow(fset, node, line), nil
+}
+
+// typeBelow returns the name of the interface or function type declared directly below line,
+// which may be one of the lines of its doc comment, or empty if there is none.
+func typeBelow(fset *token.FileSet, file *ast.File, line int) string {
+	if line <= 0 {
+		return ""
+	}
+	for _, decl := range file.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.TYPE {
+			continue
+		}
+		for _, spec := range gen.Specs {
+			typeSpec := spec.(*ast.TypeSpec)
+			pos, doc := typeSpec.Pos(), typeSpec.Doc
+			if !gen.Lparen.IsValid() {
+				pos, doc = gen.Pos(), gen.Doc
+			}
+			if doc == nil {
+				continue
+			}
+			if line < fset.Position(doc.Pos()).Line || line >= fset.Position(pos).Line {
+				continue
+			}
+			switch typeSpec.Type.(type) {
+			case *ast.InterfaceType, *ast.FuncType:
+				return typeSpec.Name.Name
+			}
+			return ""
+		}
+	}
+	return ""
+}
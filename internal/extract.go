@@ -0,0 +1,451 @@
+package internal
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"strconv"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// Extractor derives interfaces from type-checked packages
+type Extractor struct {
+	f      *File
+	pkg    *types.Package
+	syntax []*ast.File
+	fset   *token.FileSet
+}
+
+// Extract appends the interface extracted from the struct type named name to the file.
+func (e *Extractor) Extract(name string) error {
+	obj := e.pkg.Scope().Lookup(name)
+	if obj == nil {
+		return fmt.Errorf("type '%s' not found in package %s", name, e.pkg.Path())
+	}
+	named, ok := obj.Type().(*types.Named)
+	if !ok {
+		return e.errorf(obj, "'%s' is not a named type", name)
+	}
+	if _, ok := named.Underlying().(*types.Struct); !ok {
+		return e.errorf(obj, "'%s' is not a struct type", name)
+	}
+
+	t := Interface{
+		Name:   fmt.Sprintf("%sInterface", name),
+		Struct: name,
+	}
+	var errs []error
+	methodSet := types.NewMethodSet(types.NewPointer(named))
+	for method := range methodSet.Methods() {
+		fn, ok := method.Obj().(*types.Func)
+		if !ok || !fn.Exported() {
+			continue
+		}
+		m, err := e.methodFromFunc(fn)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		t.Declared = append(t.Declared, *m)
+		if m.Params.BeGenerated() {
+			t.Methods = append(t.Methods, *m)
+		}
+	}
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+	if len(t.Methods) == 0 {
+		return e.errorf(obj, "'%s' has no exported methods that accept context.Context", name)
+	}
+	e.f.Interfaces = append(e.f.Interfaces, t)
+	return nil
+}
+
+// ExtractInterface appends the interface type or the function type named name to the file.
+func (e *Extractor) ExtractInterface(name string) error {
+	obj := e.pkg.Scope().Lookup(name)
+	if obj == nil {
+		return fmt.Errorf("type '%s' not found in package %s", name, e.pkg.Path())
+	}
+	if !obj.Exported() {
+		return e.errorf(
+			obj,
+			"unexported type '%s' cannot be referred from package %s",
+			name,
+			e.f.PackageName,
+		)
+	}
+	if sig, ok := obj.Type().Underlying().(*types.Signature); ok {
+		return e.extractFunc(obj, sig)
+	}
+	iface, ok := obj.Type().Underlying().(*types.Interface)
+	if !ok {
+		return e.errorf(obj, "'%s' is not an interface or function type", name)
+	}
+
+	t := Interface{
+		Name: name,
+	}
+	var errs []error
+	for fn := range iface.Methods() {
+		m, err := e.methodFromFunc(fn)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		t.Declared = append(t.Declared, *m)
+		if m.Params.BeGenerated() {
+			t.Methods = append(t.Methods, *m)
+		}
+	}
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+	if len(t.Methods) == 0 {
+		return e.errorf(obj, "'%s' has no methods that accept context.Context", name)
+	}
+	e.f.Interfaces = append(e.f.Interfaces, t)
+	return nil
+}
+
+// Declare populates the declared methods of t with the method set of the interface type of the same name,
+// including the methods of embedded interfaces.
+func (e *Extractor) Declare(t *Interface) error {
+	obj := e.pkg.Scope().Lookup(t.Name)
+	if obj == nil {
+		return fmt.Errorf("type '%s' not found in package %s", t.Name, e.pkg.Path())
+	}
+	iface, ok := obj.Type().Underlying().(*types.Interface)
+	if !ok {
+		return e.errorf(obj, "'%s' is not an interface type", t.Name)
+	}
+	t.Declared = make([]Method, 0, iface.NumMethods())
+	var errs []error
+	for fn := range iface.Methods() {
+		m, err := e.methodFromFunc(fn)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		t.Declared = append(t.Declared, *m)
+	}
+	return errors.Join(errs...)
+}
+
+func (e *Extractor) methodFromFunc(fn *types.Func) (*Method, error) {
+	return e.methodFromSignature(fn, fn.Signature())
+}
+
+// extractFunc appends the function type of obj whose underlying type is sig to the file.
+func (e *Extractor) extractFunc(obj types.Object, sig *types.Signature) error {
+	m, err := e.methodFromSignature(obj, sig)
+	if err != nil {
+		return err
+	}
+	if !m.Params.BeGenerated() {
+		return e.errorf(obj, "'%s' does not accept context.Context", obj.Name())
+	}
+	e.f.Interfaces = append(e.f.Interfaces, Interface{
+		Name:     obj.Name(),
+		Methods:  []Method{*m},
+		Declared: []Method{*m},
+		Function: true,
+	})
+	return nil
+}
+
+// methodFromSignature returns the method named after obj with the signature sig.
+func (e *Extractor) methodFromSignature(obj types.Object, sig *types.Signature) (*Method, error) {
+	m := &Method{
+		Name:    obj.Name(),
+		Async:   hasDirective(e.doc(obj.Pos()), directiveAsync),
+		Params:  make([]Value, 0, sig.Params().Len()),
+		Returns: make([]Value, 0, sig.Results().Len()),
+	}
+	for i := range sig.Params().Len() {
+		val, err := e.valueFromType(sig.Params().At(i).Type())
+		if err != nil {
+			return nil, e.errorf(obj, "%v", err)
+		}
+		if sig.Variadic() && i == sig.Params().Len()-1 {
+			val = &Value{
+				Type:    typeVariadic,
+				Element: val.Element,
+			}
+		}
+		m.Params = append(m.Params, *val)
+	}
+	for result := range sig.Results().Variables() {
+		val, err := e.valueFromType(result.Type())
+		if err != nil {
+			return nil, e.errorf(obj, "%v", err)
+		}
+		m.Returns = append(m.Returns, *val)
+	}
+	return m, nil
+}
+
+func (e *Extractor) valueFromType(t types.Type) (*Value, error) {
+	switch t := t.(type) {
+	case *types.Basic:
+		return &Value{
+			Type: t.Name(),
+		}, nil
+	case *types.Alias:
+		return e.valueFromTypeName(t.Obj())
+	case *types.Named:
+		val, err := e.valueFromTypeName(t.Obj())
+		if err != nil {
+			return nil, err
+		}
+		for arg := range t.TypeArgs().Types() {
+			argVal, err := e.valueFromType(arg)
+			if err != nil {
+				return nil, err
+			}
+			val.TypeArgs = append(val.TypeArgs, *argVal)
+		}
+		return val, nil
+	case *types.Pointer:
+		el, err := e.valueFromType(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return &Value{
+			Type:    typePointer,
+			Element: el,
+		}, nil
+	case *types.Array:
+		el, err := e.valueFromType(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return &Value{
+			Type:    typeArray,
+			Len:     strconv.FormatInt(t.Len(), 10),
+			Element: el,
+		}, nil
+	case *types.Slice:
+		el, err := e.valueFromType(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return &Value{
+			Type:    typeSlice,
+			Element: el,
+		}, nil
+	case *types.Map:
+		k, err := e.valueFromType(t.Key())
+		if err != nil {
+			return nil, err
+		}
+		el, err := e.valueFromType(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return &Value{
+			Type:    typeMap,
+			Key:     k,
+			Element: el,
+		}, nil
+	case *types.Chan:
+		el, err := e.valueFromType(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		switch t.Dir() {
+		case types.SendOnly:
+			return &Value{
+				Type:    typeChannelSend,
+				Element: el,
+			}, nil
+		case types.RecvOnly:
+			return &Value{
+				Type:    typeChannelReceive,
+				Element: el,
+			}, nil
+		}
+		return &Value{
+			Type:    typeChannel,
+			Element: el,
+		}, nil
+	case *types.Signature:
+		params := make(Params, 0, t.Params().Len())
+		for i := range t.Params().Len() {
+			val, err := e.valueFromType(t.Params().At(i).Type())
+			if err != nil {
+				return nil, err
+			}
+			if t.Variadic() && i == t.Params().Len()-1 {
+				val = &Value{
+					Type:    typeVariadic,
+					Element: val.Element,
+				}
+			}
+			val.Name = t.Params().At(i).Name()
+			params = append(params, *val)
+		}
+		rets := make(Returns, 0, t.Results().Len())
+		for result := range t.Results().Variables() {
+			val, err := e.valueFromType(result.Type())
+			if err != nil {
+				return nil, err
+			}
+			val.Name = result.Name()
+			rets = append(rets, *val)
+		}
+		return &Value{
+			Type:    typeFunction,
+			Params:  params,
+			Returns: rets,
+		}, nil
+	case *types.Struct:
+		fields := make([]Value, 0, t.NumFields())
+		for i := range t.NumFields() {
+			field := t.Field(i)
+			if err := e.checkExported(field.Name(), field.Pkg(), "field"); err != nil {
+				return nil, err
+			}
+			val, err := e.valueFromType(field.Type())
+			if err != nil {
+				return nil, err
+			}
+			if !field.Embedded() {
+				val.Name = field.Name()
+			}
+			if tag := t.Tag(i); tag != "" {
+				val.Tag = strconv.Quote(tag)
+			}
+			fields = append(fields, *val)
+		}
+		return &Value{
+			Type:   typeStruct,
+			Fields: fields,
+		}, nil
+	case *types.Interface:
+		fields := make([]Value, 0, t.NumExplicitMethods()+t.NumEmbeddeds())
+		for i := range t.NumEmbeddeds() {
+			val, err := e.valueFromType(t.EmbeddedType(i))
+			if err != nil {
+				return nil, err
+			}
+			fields = append(fields, *val)
+		}
+		for i := range t.NumExplicitMethods() {
+			fn := t.ExplicitMethod(i)
+			if err := e.checkExported(fn.Name(), fn.Pkg(), "method"); err != nil {
+				return nil, err
+			}
+			val, err := e.valueFromType(fn.Signature())
+			if err != nil {
+				return nil, err
+			}
+			val.Name = fn.Name()
+			fields = append(fields, *val)
+		}
+		return &Value{
+			Type:   typeInterface,
+			Fields: fields,
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported type: %s", t)
+	}
+}
+
+// checkExported returns an error if name of a field or a method of an anonymous type declared in pkg is unexported
+// and the type cannot be referred from the package of the generated code.
+func (e *Extractor) checkExported(name string, pkg *types.Package, kind string) error {
+	if token.IsExported(name) || name == "_" || pkg == nil || (pkg == e.pkg && !e.f.DifferInDest) {
+		return nil
+	}
+	return fmt.Errorf(
+		"anonymous type with unexported %s '%s' cannot be referred from package %s",
+		kind,
+		name,
+		e.f.PackageName,
+	)
+}
+
+func (e *Extractor) valueFromTypeName(obj *types.TypeName) (*Value, error) {
+	pkg := obj.Pkg()
+	if pkg == nil || (pkg == e.pkg && !e.f.DifferInDest) {
+		return &Value{
+			Type: obj.Name(),
+		}, nil
+	}
+	if !obj.Exported() {
+		return nil, fmt.Errorf(
+			"unexported type '%s' cannot be referred from package %s",
+			obj.Name(),
+			e.f.PackageName,
+		)
+	}
+	e.f.Imports[pkg.Name()] = Package{
+		Path: pkg.Path(),
+	}
+	return &Value{
+		Type: obj.Name(),
+		Package: &Package{
+			Path: pkg.Path(),
+			Name: pkg.Name(),
+		},
+	}, nil
+}
+
+func newExtractor(f *File, pkg *packages.Package) *Extractor {
+	return &Extractor{
+		f:      f,
+		pkg:    pkg.Types,
+		syntax: pkg.Syntax,
+		fset:   pkg.Fset,
+	}
+}
+
+// errorf returns a Diagnostic at the position of obj.
+func (e *Extractor) errorf(obj types.Object, format string, args ...any) *Diagnostic {
+	d := &Diagnostic{
+		Message: fmt.Sprintf(format, args...),
+	}
+	if e.fset != nil {
+		d.Pos = positionOf(e.fset, obj.Pos())
+	}
+	return d
+}
+
+// doc returns the doc comment of the method or the interface method declared at pos.
+// It returns nil if the declaration is not in the syntax of the package.
+func (e *Extractor) doc(pos token.Pos) *ast.CommentGroup {
+	var doc *ast.CommentGroup
+	for _, file := range e.syntax {
+		if pos < file.FileStart || pos > file.FileEnd {
+			continue
+		}
+		ast.Inspect(file, func(n ast.Node) bool {
+			switch n := n.(type) {
+			case *ast.FuncDecl:
+				if n.Name.Pos() == pos {
+					doc = n.Doc
+				}
+				return false
+			case *ast.GenDecl:
+				for _, spec := range n.Specs {
+					if spec, ok := spec.(*ast.TypeSpec); ok && spec.Name.Pos() == pos {
+						doc = cmp.Or(spec.Doc, n.Doc)
+					}
+				}
+			case *ast.Field:
+				for _, name := range n.Names {
+					if name.Pos() == pos {
+						doc = n.Doc
+					}
+				}
+			}
+			return doc == nil
+		})
+	}
+	return doc
+}
@@ -0,0 +1,332 @@
+package internal
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/token"
+	"iter"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"golang.org/x/tools/go/ast/astutil"
+	"golang.org/x/tools/imports"
+)
+
+// newrelicPath is the import path of the New Relic Go agent.
+const newrelicPath = "github.com/newrelic/go-agent/v3/newrelic"
+
+// Inject returns the source of the file at path with a segment started at the top of the body of every function and
+// method accepting a named context.Context, such as:
+//
+//	defer newrelic.FromContext(ctx).StartSegment("pkg.Type.Method").End() //nrdeco:inject
+//
+// The inserted statements are marked with the directive //nrdeco:inject,
+// so that injecting again only brings them up to date and Strip removes them.
+// Functions already starting a segment with a deferred StartSegment call, and generated files, are left untouched.
+// The source is returned as is if nothing changes, and formatted with gofmt otherwise.
+func Inject(path string, opts ...Option) ([]byte, error) {
+	return rewrite(path, newOptions(opts...), true)
+}
+
+// Strip returns the source of the file at path without the statements inserted by Inject.
+// The import of the New Relic Go agent is removed as well if it is no longer used.
+func Strip(path string) ([]byte, error) {
+	return rewrite(path, newOptions(), false)
+}
+
+// edit replaces src[start:end] with text.
+type edit struct {
+	start int
+	end   int
+	text  string
+}
+
+// injector rewrites the bodies of the functions in a file.
+type injector struct {
+	o        *options
+	fset     *token.FileSet
+	file     *ast.File
+	src      []byte
+	f        *File
+	visitor  *Visitor
+	newrelic string
+	markers  map[int]*ast.Comment
+	edits    []edit
+}
+
+func rewrite(path string, o *options, inject bool) ([]byte, error) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	fset := token.NewFileSet()
+	file, err := parseFile(fset, path, src)
+	if err != nil {
+		return nil, err
+	}
+	if ast.IsGenerated(file) {
+		return src, nil
+	}
+	i := newInjector(o, fset, file, src)
+	for decl := range i.funcDecls() {
+		var stmts []string
+		if inject {
+			stmts, err = i.statements(decl)
+			if err != nil {
+				return nil, err
+			}
+		}
+		i.replace(decl.Body, stmts)
+	}
+	if len(i.edits) == 0 {
+		return src, nil
+	}
+	return i.apply()
+}
+
+func newInjector(o *options, fset *token.FileSet, file *ast.File, src []byte) *injector {
+	f := newFile("", file.Name.Name, o)
+	i := &injector{
+		o:        o,
+		fset:     fset,
+		file:     file,
+		src:      src,
+		f:        f,
+		visitor:  newVisitor(f, fset, file.Imports, func(string) bool { return true }),
+		newrelic: "newrelic",
+		markers:  make(map[int]*ast.Comment),
+	}
+	for _, spec := range file.Imports {
+		if path, _ := strconv.Unquote(spec.Path.Value); path == newrelicPath && spec.Name != nil {
+			i.newrelic = spec.Name.Name
+		}
+	}
+	for _, group := range file.Comments {
+		for _, c := range group.List {
+			if c.Text == "//"+directiveInject {
+				i.markers[fset.Position(c.Pos()).Line] = c
+			}
+		}
+	}
+	return i
+}
+
+// funcDecls yields the functions and methods with bodies.
+func (i *injector) funcDecls() iter.Seq[*ast.FuncDecl] {
+	return func(yield func(*ast.FuncDecl) bool) {
+		for _, decl := range i.file.Decls {
+			if decl, ok := decl.(*ast.FuncDecl); ok && decl.Body != nil {
+				if !yield(decl) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// statements returns the statements to be inserted at the top of the body of decl,
+// or nil if decl is not to be instrumented.
+func (i *injector) statements(decl *ast.FuncDecl) ([]string, error) {
+	params, err := i.visitor.valuesFromFields(decl.Type.Params)
+	if err != nil {
+		i.o.warn(fmt.Sprintf("%v; %s is left untouched", err, decl.Name.Name))
+		return nil, nil
+	}
+	ctxIdx := slices.IndexFunc(params, func(param Value) bool {
+		return param.IsContext() && param.Name != "" && param.Name != "_"
+	})
+	if ctxIdx == -1 || i.startsSegment(decl.Body) {
+		return nil, nil
+	}
+	ctx := params[ctxIdx].Name
+
+	t := Interface{
+		Name:     decl.Name.Name,
+		Function: true,
+	}
+	if decl.Recv != nil && len(decl.Recv.List) > 0 {
+		t = Interface{
+			Name: receiverTypeName(decl.Recv.List[0].Type),
+		}
+	}
+	m := Method{
+		Name: decl.Name.Name,
+	}
+	key := fmt.Sprintf("%s.%s", t.Target(), m.Name)
+	if i.o.methods[key].Skip {
+		return nil, nil
+	}
+	segment, err := i.o.segmentName(i.f, &t, &m)
+	if err != nil {
+		return nil, err
+	}
+
+	// The segment is started on the transaction of the caller, as the generated decorators do.
+	stmts := []string{
+		fmt.Sprintf("defer %s.FromContext(%s).StartSegment(%q).End()", i.newrelic, ctx, segment),
+	}
+	if hasDirective(decl.Doc, directiveAsync) || i.o.methods[key].Async {
+		stmts = append(stmts, fmt.Sprintf(
+			"%[1]s = %[2]s.NewContext(%[1]s, %[2]s.FromContext(%[1]s).NewGoroutine())",
+			ctx,
+			i.newrelic,
+		))
+	}
+	for j := range stmts {
+		stmts[j] = fmt.Sprintf("%s //%s", stmts[j], directiveInject)
+	}
+	return stmts, nil
+}
+
+// startsSegment returns true if body defers a StartSegment call not inserted by Inject, otherwise false.
+func (i *injector) startsSegment(body *ast.BlockStmt) bool {
+	for _, stmt := range body.List {
+		deferStmt, ok := stmt.(*ast.DeferStmt)
+		if !ok || i.marker(stmt) != nil {
+			continue
+		}
+		found := false
+		ast.Inspect(deferStmt.Call, func(node ast.Node) bool {
+			if sel, ok := node.(*ast.SelectorExpr); ok && sel.Sel.Name == "StartSegment" {
+				found = true
+			}
+			return !found
+		})
+		if found {
+			return true
+		}
+	}
+	return false
+}
+
+// marker returns the //nrdeco:inject comment following stmt on the same line, or nil if there is none.
+func (i *injector) marker(stmt ast.Stmt) *ast.Comment {
+	c, ok := i.markers[i.fset.Position(stmt.End()).Line]
+	if !ok || c.Pos() < stmt.End() {
+		return nil
+	}
+	return c
+}
+
+// replace records the edits replacing the marked statements in body with stmts.
+// Nothing is recorded if body already starts with stmts.
+func (i *injector) replace(body *ast.BlockStmt, stmts []string) {
+	var current []string
+	var removals []edit
+	for j, stmt := range body.List {
+		c := i.marker(stmt)
+		if c == nil {
+			continue
+		}
+		if j == len(current) {
+			src := i.src[i.offset(stmt.Pos()):i.offset(stmt.End())]
+			current = append(current, fmt.Sprintf("%s %s", src, c.Text))
+		}
+		start := i.offset(i.fset.File(stmt.Pos()).LineStart(i.fset.Position(stmt.Pos()).Line))
+		end := i.offset(c.End())
+		if end < len(i.src) && i.src[end] == '\n' {
+			end++
+		}
+		removals = append(removals, edit{start: start, end: end})
+	}
+	if len(removals) == len(current) && slices.Equal(current, stmts) {
+		return
+	}
+	i.edits = append(i.edits, removals...)
+	if len(stmts) > 0 {
+		lbrace := i.offset(body.Lbrace) + 1
+		text := "\n" + strings.Join(stmts, "\n")
+		if lbrace < len(i.src) && i.src[lbrace] != '\n' {
+			// the body continues on the line of the brace, which must not follow the marker.
+			text += "\n"
+		}
+		i.edits = append(i.edits, edit{
+			start: lbrace,
+			end:   lbrace,
+			text:  text,
+		})
+	}
+}
+
+func (i *injector) offset(pos token.Pos) int {
+	return i.fset.Position(pos).Offset
+}
+
+// apply applies the recorded edits, fixes the import of the New Relic Go agent and formats the result.
+func (i *injector) apply() ([]byte, error) {
+	slices.SortStableFunc(i.edits, func(a, b edit) int {
+		return b.start - a.start
+	})
+	src := slices.Clone(i.src)
+	for _, e := range i.edits {
+		src = slices.Concat(src[:e.start], []byte(e.text), src[e.end:])
+	}
+
+	fset := token.NewFileSet()
+	file, err := parseFile(fset, i.fset.Position(i.file.Pos()).Filename, src)
+	if err != nil {
+		return nil, err
+	}
+	used := false
+	ast.Inspect(file, func(node ast.Node) bool {
+		if sel, ok := node.(*ast.SelectorExpr); ok {
+			if x, ok := sel.X.(*ast.Ident); ok && x.Name == i.newrelic {
+				used = true
+			}
+		}
+		return !used
+	})
+	switch {
+	case used && i.newrelic == "newrelic":
+		astutil.AddImport(fset, file, newrelicPath)
+	case !used:
+		astutil.DeleteNamedImport(fset, file, i.importName(), newrelicPath)
+	}
+	filename := fset.Position(file.Pos()).Filename
+	var buf bytes.Buffer
+	if err := format.Node(&buf, fset, file); err != nil {
+		return nil, fmt.Errorf("failed to format %s: %w", filename, err)
+	}
+	b, err := imports.Process(filename, buf.Bytes(), &imports.Options{
+		Comments:   true,
+		TabIndent:  true,
+		TabWidth:   8,
+		FormatOnly: true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to format %s: %w", filename, err)
+	}
+	return b, nil
+}
+
+// importName returns the explicit name of the import of the New Relic Go agent, or empty if there is none.
+func (i *injector) importName() string {
+	if i.newrelic == "newrelic" {
+		return ""
+	}
+	return i.newrelic
+}
+
+// receiverTypeName returns the name of the type of a method receiver, such as "T" for "*T" or "T[K, V]".
+func receiverTypeName(expr ast.Expr) string {
+	for {
+		switch e := expr.(type) {
+		case *ast.StarExpr:
+			expr = e.X
+		case *ast.ParenExpr:
+			expr = e.X
+		case *ast.IndexExpr:
+			expr = e.X
+		case *ast.IndexListExpr:
+			expr = e.X
+		case *ast.Ident:
+			return e.Name
+		default:
+			return ""
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/token"
+
+	"golang.org/x/tools/go/ast/astutil"
+	"golang.org/x/tools/go/packages"
+)
+
+const (
+	// reasonNoContext is the reason a method is not instrumented for lack of a context.Context parameter.
+	reasonNoContext = "no context.Context parameter"
+	// reasonSkipped is the reason a method is not instrumented because the configuration skips it.
+	reasonSkipped = "skipped by configuration"
+)
+
+// Entry describes a method of an interface, or a function type, found by List.
+type Entry struct {
+	// File is the file declaring the interface.
+	File string `json:"file"`
+	// Interface is the name of the interface or function type.
+	Interface string `json:"interface"`
+	// Method is the name of the method. It is empty for function types.
+	Method string `json:"method,omitempty"`
+	// Instrumented is true if the decorator starts a segment in the method.
+	Instrumented bool `json:"instrumented"`
+	// Reason is why the method is not instrumented. It is empty if Instrumented is true.
+	Reason string `json:"reason,omitempty"`
+	// Segment is the name of the segment started in the method. It is empty if Instrumented is false.
+	Segment string `json:"segment,omitempty"`
+}
+
+// List returns the methods of the interfaces and the function types declared in the source file,
+// telling whether Generate instruments them when the decorators are generated next to the source,
+// and the names of their segments if so. Generated files are listed as empty.
+func List(source string, opts ...Option) ([]Entry, error) {
+	o := newOptions(opts...)
+	f, err := discover(source, o)
+	if err != nil || f == nil {
+		return nil, err
+	}
+
+	var entries []Entry
+	for _, t := range f.Interfaces {
+		for _, m := range t.Declared {
+			entry := Entry{
+				File:      source,
+				Interface: t.Name,
+			}
+			if !t.Function {
+				entry.Method = m.Name
+			}
+			switch {
+			case !m.Params.BeGenerated():
+				entry.Reason = reasonNoContext
+			case o.methods[fmt.Sprintf("%s.%s", t.Target(), m.Name)].Skip:
+				entry.Reason = reasonSkipped
+			default:
+				entry.Segment, err = o.segmentName(f, &t, &m)
+				if err != nil {
+					return nil, err
+				}
+				entry.Instrumented = true
+			}
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+// Decorated returns the interfaces and the function types in the source file decorated by Generate
+// when the decorators are generated next to the source, named as configured by opts.
+// Generated files have none.
+func Decorated(source string, opts ...Option) (*File, error) {
+	o := newOptions(opts...)
+	f, err := discover(source, o)
+	if err != nil || f == nil {
+		return nil, err
+	}
+	if err := o.apply(f); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// discover finds the interfaces and the function types declared in the source file as Generate does,
+// including those without methods to be instrumented. It returns nil for generated files.
+func discover(source string, o *options) (*File, error) {
+	fset := token.NewFileSet()
+	nodes, err := parseFile(fset, source, nil)
+	if err != nil {
+		return nil, err
+	}
+	if ast.IsGenerated(nodes) {
+		return nil, nil
+	}
+	f := newFile("", nodes.Name.Name, o)
+	visitor := newVisitor(f, fset, nodes.Imports, o.selected)
+	astutil.Apply(nodes, nil, visitor.Visit)
+	if len(visitor.diagnostics) > 0 {
+		return nil, errors.Join(visitor.diagnostics...)
+	}
+	return f, nil
+}
+
+// SourcePackage is a package loaded by LoadPackages.
+type SourcePackage struct {
+	// Path is the import path of the package.
+	Path string
+	// Name is the name of the package.
+	Name string
+	// Files are the Go files of the package other than tests.
+	Files []string
+}
+
+// LoadPackages loads the packages matched by patterns with their Go files other than tests.
+func LoadPackages(patterns ...string) ([]SourcePackage, error) {
+	pkgs, err := packages.Load(&packages.Config{
+		Mode: packages.NeedName | packages.NeedFiles,
+	}, patterns...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load packages: %w", err)
+	}
+	var sources []SourcePackage
+	var errs []error
+	for _, pkg := range pkgs {
+		for _, pkgErr := range pkg.Errors {
+			errs = append(errs, diagnosticFromPackageError(pkgErr))
+		}
+		sources = append(sources, SourcePackage{
+			Path:  pkg.PkgPath,
+			Name:  pkg.Name,
+			Files: pkg.GoFiles,
+		})
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return sources, nil
+}
@@ -0,0 +1,249 @@
+package internal
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// ManifestFileName is the name of the manifest recording the files generated in a module, placed at its root.
+const ManifestFileName = ".nrdeco-manifest.json"
+
+// generatedHeader is the beginning of the files generated by nrdeco.
+const generatedHeader = "// Code generated by nrdeco"
+
+// Manifest records the files generated by nrdeco in a module.
+type Manifest struct {
+	// Path is the path of the manifest file.
+	Path string `json:"-"`
+	// Files are the generated files, sorted by Dest.
+	Files []ManifestEntry `json:"files"`
+}
+
+// ManifestEntry records a generated file.
+type ManifestEntry struct {
+	// Dest is the generated file, relative to the root of the module.
+	Dest string `json:"dest"`
+	// Source is the source file relative to the root of the module. It is empty if Package is set.
+	Source string `json:"source,omitempty"`
+	// Package is the import path of the package the file is generated from with --from-package.
+	Package string `json:"package,omitempty"`
+	// Types are the decorated types, which are the interfaces and the function types, or the struct types if Extracted.
+	Types []string `json:"types"`
+	// Extracted is true if the interfaces are extracted from the struct types in Types.
+	Extracted bool `json:"extracted,omitempty"`
+}
+
+// manifestLockTimeout is how long LockManifest waits for the lock held by another process.
+// A lock file older than this is considered left behind by a process which did not release it.
+const manifestLockTimeout = 10 * time.Second
+
+// LockManifest loads the manifest of the module containing dir and holds a lock on it until unlock is called,
+// so that nrdeco running in parallel for several packages does not lose entries.
+// It returns an empty manifest if the module has none yet, and nil if dir is not in a module.
+func LockManifest(dir string) (m *Manifest, unlock func(), err error) {
+	gomod, err := FindModule(dir)
+	if err != nil || gomod == "" {
+		return nil, nil, err
+	}
+	path := filepath.Join(filepath.Dir(gomod), ManifestFileName)
+	unlock, err = lockFile(path + ".lock")
+	if err != nil {
+		return nil, nil, err
+	}
+	m, err = readManifest(path)
+	if err != nil {
+		unlock()
+		return nil, nil, err
+	}
+	return m, unlock, nil
+}
+
+// lockFile acquires the lock represented by the existence of the file at path, waiting while another process holds it.
+func lockFile(path string) (func(), error) {
+	deadline := time.Now().Add(manifestLockTimeout)
+	for {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+		if err == nil {
+			_ = f.Close()
+			return func() {
+				_ = os.Remove(path)
+			}, nil
+		}
+		if !errors.Is(err, fs.ErrExist) {
+			return nil, fmt.Errorf("failed to create %s: %w", path, err)
+		}
+		if info, err := os.Stat(path); err == nil && time.Since(info.ModTime()) > manifestLockTimeout {
+			// The lock is stale, e.g. left behind by a killed process.
+			_ = os.Remove(path)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("timed out waiting for %s; remove it if no nrdeco is running", path)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// readManifest reads the manifest at path, which is empty if the file does not exist.
+func readManifest(path string) (*Manifest, error) {
+	m := &Manifest{
+		Path: path,
+	}
+	b, err := os.ReadFile(m.Path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", m.Path, err)
+	}
+	if err := json.Unmarshal(b, m); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", m.Path, err)
+	}
+	return m, nil
+}
+
+// Root returns the root directory of the module.
+func (m *Manifest) Root() string {
+	return filepath.Dir(m.Path)
+}
+
+// Rel returns path relative to the root of the module with slashes.
+func (m *Manifest) Rel(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to get absolute path of %s: %w", path, err)
+	}
+	rel, err := filepath.Rel(m.Root(), abs)
+	if err != nil {
+		return "", fmt.Errorf("failed to get relative path of %s: %w", path, err)
+	}
+	return filepath.ToSlash(rel), nil
+}
+
+// Abs returns the path of rel, which is relative to the root of the module.
+func (m *Manifest) Abs(rel string) string {
+	return filepath.Join(m.Root(), filepath.FromSlash(rel))
+}
+
+// Record adds entry to the manifest, replacing the one of the same destination.
+func (m *Manifest) Record(entry ManifestEntry) {
+	m.Remove(entry.Dest)
+	i, _ := slices.BinarySearchFunc(m.Files, entry.Dest, func(e ManifestEntry, dest string) int {
+		return cmp.Compare(e.Dest, dest)
+	})
+	m.Files = slices.Insert(m.Files, i, entry)
+}
+
+// Remove removes the entry of dest from the manifest.
+func (m *Manifest) Remove(dest string) {
+	m.Files = slices.DeleteFunc(m.Files, func(e ManifestEntry) bool {
+		return e.Dest == dest
+	})
+}
+
+// Save writes the manifest to its path, which is removed instead if the manifest is empty.
+func (m *Manifest) Save() error {
+	if len(m.Files) == 0 {
+		if err := os.Remove(m.Path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("failed to remove %s: %w", m.Path, err)
+		}
+		return nil
+	}
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode %s: %w", m.Path, err)
+	}
+	_, err = WriteFile(m.Path, append(b, '\n'))
+	return err
+}
+
+// Orphaned returns the reason why the generated file of entry is orphaned, or empty if it is not.
+// The file is orphaned if its source or package no longer exists, or none of the decorated types is declared there.
+// An entry without decorated types is orphaned only if its source or package no longer exists.
+func (m *Manifest) Orphaned(entry ManifestEntry) (string, error) {
+	var files []string
+	switch {
+	case entry.Package != "":
+		pkgs, err := packages.Load(&packages.Config{
+			Mode: packages.NeedName | packages.NeedFiles,
+			Dir:  filepath.Dir(m.Abs(entry.Dest)),
+		}, entry.Package)
+		if err != nil {
+			return "", fmt.Errorf("failed to load packages: %w", err)
+		}
+		for _, pkg := range pkgs {
+			if len(pkg.Errors) == 0 {
+				files = append(files, pkg.GoFiles...)
+			}
+		}
+		if len(files) == 0 {
+			return fmt.Sprintf("package %s no longer exists", entry.Package), nil
+		}
+	case entry.Extracted:
+		source := m.Abs(entry.Source)
+		if _, err := os.Stat(source); errors.Is(err, fs.ErrNotExist) {
+			return fmt.Sprintf("%s no longer exists", entry.Source), nil
+		}
+		entries, err := os.ReadDir(filepath.Dir(source))
+		if err != nil {
+			return "", fmt.Errorf("failed to read %s: %w", filepath.Dir(source), err)
+		}
+		for _, e := range entries {
+			name := e.Name()
+			if !e.IsDir() && filepath.Ext(name) == ".go" && !strings.HasSuffix(name, "_test.go") {
+				files = append(files, filepath.Join(filepath.Dir(source), name))
+			}
+		}
+	default:
+		source := m.Abs(entry.Source)
+		if _, err := os.Stat(source); errors.Is(err, fs.ErrNotExist) {
+			return fmt.Sprintf("%s no longer exists", entry.Source), nil
+		}
+		files = append(files, source)
+	}
+	if len(entry.Types) == 0 {
+		// The decorated types are unknown, e.g. if none was decorated when the entry was recorded.
+		return "", nil
+	}
+
+	fset := token.NewFileSet()
+	for _, file := range files {
+		node, err := parser.ParseFile(fset, file, nil, parser.SkipObjectResolution)
+		if err != nil {
+			continue
+		}
+		for _, ident := range topLevelIdents(node) {
+			if slices.Contains(entry.Types, ident.Name) {
+				return "", nil
+			}
+		}
+	}
+	return fmt.Sprintf(
+		"none of %s is declared in %s anymore",
+		strings.Join(entry.Types, ", "),
+		cmp.Or(entry.Package, entry.Source),
+	), nil
+}
+
+// IsGeneratedByNrdeco returns true if the file at path begins with the header of the files generated by nrdeco,
+// otherwise false.
+func IsGeneratedByNrdeco(path string) (bool, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return false, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return bytes.HasPrefix(b, []byte(generatedHeader)), nil
+}
@@ -0,0 +1,210 @@
+package internal
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"unicode"
+	"unicode/utf8"
+)
+
+// DefaultPrefix is the default prefix of the decorator type names.
+const DefaultPrefix = "NR"
+
+// TypeNameData is the data applied to the templates of the decorator type names.
+type TypeNameData struct {
+	// Package is the name of the package of the generated code.
+	Package string
+	// Type is the name of the decorated type.
+	Type string
+}
+
+func parseTypeNameTemplate(s string) (*template.Template, error) {
+	return template.New("type-name").Option("missingkey=error").Parse(s)
+}
+
+// decoratorName returns the name of the decorator type of t.
+// It is unexported if the decorated type is.
+func (o *options) decoratorName(f *File, t *Interface) (string, error) {
+	name := fmt.Sprintf("%s%s%s", o.prefix, t.Target(), o.suffix)
+	if !token.IsExported(t.Target()) {
+		name = unexport(fmt.Sprintf("%s%s%s", o.prefix, upperFirst(t.Target()), o.suffix))
+	}
+	if o.typeName != "" {
+		tpl, err := parseTypeNameTemplate(o.typeName)
+		if err != nil {
+			return "", fmt.Errorf("invalid type name template '%s': %w", o.typeName, err)
+		}
+		var buf bytes.Buffer
+		err = tpl.Execute(&buf, TypeNameData{
+			Package: f.PackageName,
+			Type:    t.Target(),
+		})
+		if err != nil {
+			return "", fmt.Errorf("failed to execute type name template '%s': %w", o.typeName, err)
+		}
+		name = buf.String()
+		if !token.IsExported(t.Target()) {
+			name = unexport(name)
+		}
+	}
+	if !token.IsIdentifier(name) {
+		return "", fmt.Errorf(
+			"decorator type name '%s' of %s is not a valid identifier",
+			name,
+			t.Target(),
+		)
+	}
+	return name, nil
+}
+
+// FuncName returns the name of the function of the decorator of i prefixed with verb, such as NewNRStore.
+// It is unexported if the decorator is, such as newNrStore.
+func (i *Interface) FuncName(verb string) string {
+	if token.IsExported(i.DecoratorName) {
+		return fmt.Sprintf("%s%s", verb, i.DecoratorName)
+	}
+	return fmt.Sprintf("%s%s", unexport(verb), upperFirst(i.DecoratorName))
+}
+
+// upperFirst returns s with its first letter in upper case.
+func upperFirst(s string) string {
+	r, size := utf8.DecodeRuneInString(s)
+	return string(unicode.ToUpper(r)) + s[size:]
+}
+
+// unexport returns s with its leading upper case letters in lower case, following the naming convention of Go,
+// such as NRStore to nrStore and HTTPClient to httpClient.
+func unexport(s string) string {
+	runes := []rune(s)
+	n := 0
+	for n < len(runes) && unicode.IsUpper(runes[n]) {
+		n++
+	}
+	if n > 1 && n < len(runes) && unicode.IsLower(runes[n]) {
+		// The last upper case letter begins the next word.
+		n--
+	}
+	for i := range n {
+		runes[i] = unicode.ToLower(runes[i])
+	}
+	return string(runes)
+}
+
+// declaredNames returns the package-level names declared by the generated code of f,
+// mapped to the names of the types they are generated for.
+func declaredNames(f *File) (map[string]string, error) {
+	names := make(map[string]string)
+	var errs []error
+	declare := func(name, target string) {
+		if other, ok := names[name]; ok {
+			errs = append(
+				errs,
+				fmt.Errorf("'%s' is generated for both %s and %s", name, other, target),
+			)
+			return
+		}
+		names[name] = target
+	}
+	for _, t := range f.Interfaces {
+		if t.Extracted() {
+			declare(t.Name, t.Target())
+		}
+		declare(t.DecoratorName, t.Target())
+		if t.Function {
+			continue
+		}
+		if f.Explicit {
+			declare(t.FuncName("New"), t.Target())
+		}
+		if len(t.Optionals) > 0 {
+			declare(t.FuncName("Wrap"), t.Target())
+		}
+	}
+	return names, errors.Join(errs...)
+}
+
+// checkDuplicates returns an error if a name declared by the generated code of f is declared twice,
+// either within f or by another file of the destination package.
+func checkDuplicates(f *File, dest string) error {
+	names, err := declaredNames(f)
+	if err != nil {
+		return err
+	}
+	absDest, err := filepath.Abs(dest)
+	if err != nil {
+		return fmt.Errorf("failed to get absolute path of %s: %w", dest, err)
+	}
+	dir := filepath.Dir(dest)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return fmt.Errorf("failed to read %s: %w", dir, err)
+	}
+
+	var errs []error
+	fset := token.NewFileSet()
+	for _, entry := range entries {
+		name := entry.Name()
+		path := filepath.Join(dir, name)
+		if entry.IsDir() || filepath.Ext(name) != ".go" || strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		if abs, err := filepath.Abs(path); err != nil || abs == absDest {
+			continue
+		}
+		node, err := parser.ParseFile(fset, path, nil, parser.SkipObjectResolution)
+		if err != nil || node.Name.Name != f.PackageName {
+			continue
+		}
+		for _, ident := range topLevelIdents(node) {
+			if target, ok := names[ident.Name]; ok {
+				errs = append(errs, fmt.Errorf(
+					"'%s' generated for %s is already declared at %s",
+					ident.Name,
+					target,
+					positionOf(fset, ident.Pos()),
+				))
+			}
+		}
+	}
+	if len(errs) > 0 {
+		errs = append(
+			errs,
+			errors.New("use --prefix, --suffix or --type-name-template to rename the decorators"),
+		)
+	}
+	return errors.Join(errs...)
+}
+
+// topLevelIdents returns the identifiers declared at the package level of file.
+func topLevelIdents(file *ast.File) []*ast.Ident {
+	var idents []*ast.Ident
+	for _, decl := range file.Decls {
+		switch decl := decl.(type) {
+		case *ast.FuncDecl:
+			if decl.Recv == nil {
+				idents = append(idents, decl.Name)
+			}
+		case *ast.GenDecl:
+			for _, spec := range decl.Specs {
+				switch spec := spec.(type) {
+				case *ast.TypeSpec:
+					idents = append(idents, spec.Name)
+				case *ast.ValueSpec:
+					idents = append(idents, spec.Names...)
+				}
+			}
+		}
+	}
+	return idents
+}
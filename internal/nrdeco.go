@@ -2,62 +2,59 @@ package internal
 
 import (
 	"bytes"
+	"cmp"
 	"context"
 	_ "embed"
+	"errors"
 	"fmt"
 	"go/ast"
 	"go/parser"
+	"go/scanner"
 	"go/token"
-	"path"
+	"go/types"
 	"path/filepath"
 	"slices"
 	"strings"
 	"text/template"
-	"unicode"
 
 	"golang.org/x/tools/go/ast/astutil"
 	"golang.org/x/tools/go/packages"
+	"golang.org/x/tools/imports"
 )
 
 //go:embed nrdeco.tmpl
 var nrdecoTemplate string
 
-func Generate(_ context.Context, source, dest, version string) ([]byte, error) {
-	tpl, err := parseTemplate()
+func Generate(_ context.Context, source, dest, version string, opts ...Option) ([]byte, error) {
+	o := newOptions(opts...)
+	fset := token.NewFileSet()
+	nodes, err := parseFile(fset, source, nil)
 	if err != nil {
 		return nil, err
 	}
 
-	nodes, err := parser.ParseFile(token.NewFileSet(), source, nil, 0)
-	if err != nil {
-		return nil, fmt.Errorf("failed to parse file %s: %w", source, err)
-	}
-
-	pkgs, err := packages.Load(&packages.Config{}, path.Dir(source))
+	sourceDir := filepath.Dir(source)
+	pkgs, err := packages.Load(&packages.Config{
+		Mode:  o.loadMode(),
+		Dir:   sourceDir,
+		Tests: strings.HasSuffix(o.packageName, "_test"),
+	}, ".")
 	if err != nil {
 		return nil, fmt.Errorf("failed to load packages: %w", err)
 	}
 	pkgIdx := slices.IndexFunc(pkgs, func(pkg *packages.Package) bool {
+		if o.packageName != "" {
+			return pkg.Name == o.packageName
+		}
 		return !strings.HasSuffix(pkg.Name, "_test")
 	})
-	if pkgIdx == -1 {
-		return nil, fmt.Errorf("non-test package not found in '%s'", path.Dir(source))
+	if pkgIdx == -1 && o.packageName != "" {
+		return nil, fmt.Errorf("package '%s' not found in '%s'", o.packageName, sourceDir)
 	}
-	f := File{
-		Version:     version,
-		PackageName: filepath.Base(pkgs[pkgIdx].ID),
-		Imports: map[string]Package{
-			"os": {
-				Path: "os",
-			},
-			"strings": {
-				Path: "strings",
-			},
-			"newrelic": {
-				Path: "github.com/newrelic/go-agent/v3/newrelic",
-			},
-		},
+	if pkgIdx == -1 {
+		return nil, fmt.Errorf("non-test package not found in '%s'", sourceDir)
 	}
+	f := newFile(version, pkgs[pkgIdx].Name, o)
 
 	absSource, err := filepath.Abs(source)
 	if err != nil {
@@ -69,40 +66,206 @@ func Generate(_ context.Context, source, dest, version string) ([]byte, error) {
 	}
 	if filepath.Dir(absSource) != filepath.Dir(absDest) {
 		f.OriginalPackageName = f.PackageName
-		destPkgs, _ := packages.Load(&packages.Config{}, path.Dir(source))
-		switch {
-		case len(destPkgs) > 0:
-			f.PackageName = filepath.Base(destPkgs[0].ID)
-		default:
-			destDir, _ := filepath.Split(dest)
-			f.PackageName = filepath.Base(destDir)
-		}
-
+		f.PackageName = cmp.Or(o.destPackage, packageNameOf(filepath.Dir(absDest)))
 		f.Imports[pkgs[pkgIdx].Name] = Package{
-			Path: pkgs[pkgIdx].ID,
+			Path: pkgs[pkgIdx].PkgPath,
 		}
 		f.DifferInDest = true
+	} else if o.destPackage != "" && o.destPackage != f.PackageName {
+		return nil, fmt.Errorf(
+			"destination package '%s' differs from package '%s' in the same directory",
+			o.destPackage,
+			f.PackageName,
+		)
+	}
+	switch {
+	case len(o.types) > 0:
+		extractor := newExtractor(f, pkgs[pkgIdx])
+		for _, name := range o.types {
+			if err := extractor.Extract(name); err != nil {
+				return nil, fmt.Errorf("error while extracting interface: %w", err)
+			}
+		}
+	default:
+		selected := o.selected
+		if name := typeBelow(fset, nodes, o.line); name != "" {
+			selected = func(n string) bool {
+				return n == name && o.selected(n)
+			}
+		}
+		visitor := newVisitor(f, fset, nodes.Imports, selected)
+		astutil.Apply(nodes, nil, visitor.Visit)
+		if len(visitor.diagnostics) > 0 {
+			return nil, errors.Join(visitor.diagnostics...)
+		}
+		if o.explicit {
+			extractor := newExtractor(f, pkgs[pkgIdx])
+			for i := range f.Interfaces {
+				if f.Interfaces[i].Function || len(f.Interfaces[i].Methods) == 0 {
+					continue
+				}
+				if err := extractor.Declare(&f.Interfaces[i]); err != nil {
+					return nil, fmt.Errorf("error while declaring interface: %w", err)
+				}
+			}
+		}
+	}
+	if err := o.apply(f); err != nil {
+		return nil, err
+	}
+	if len(o.optionals) > 0 {
+		if err := checkOptionals(f, pkgs[pkgIdx], sourceDir); err != nil {
+			return nil, err
+		}
+	}
+	if err := checkDuplicates(f, dest); err != nil {
+		return nil, err
+	}
+	o.decorated(f.Targets())
+	return execute(f, dest)
+}
+
+// GenerateFromPackage generates decorators for the interfaces declared in the package specified by pkgPath,
+// which is resolved from the module containing dest.
+func GenerateFromPackage(
+	_ context.Context,
+	pkgPath, dest, version string,
+	opts ...Option,
+) ([]byte, error) {
+	o := newOptions(opts...)
+	if len(o.interfaces) == 0 {
+		return nil, fmt.Errorf("no interfaces specified for package %s", pkgPath)
+	}
+
+	destDir := filepath.Dir(dest)
+	pkgs, err := packages.Load(&packages.Config{Mode: typesLoadMode, Dir: destDir}, pkgPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load packages: %w", err)
+	}
+	if len(pkgs) != 1 {
+		return nil, fmt.Errorf("expected exactly one package for '%s', got %d", pkgPath, len(pkgs))
+	}
+	pkg := pkgs[0]
+	if len(pkg.Errors) > 0 {
+		errs := make([]error, 0, len(pkg.Errors))
+		for _, pkgErr := range pkg.Errors {
+			errs = append(errs, diagnosticFromPackageError(pkgErr))
+		}
+		return nil, fmt.Errorf("failed to load package %s: %w", pkgPath, errors.Join(errs...))
+	}
+
+	f := newFile(version, cmp.Or(o.destPackage, packageNameOf(destDir)), o)
+	f.OriginalPackageName = pkg.Name
+	f.Imports[pkg.Name] = Package{
+		Path: pkg.PkgPath,
+	}
+	f.DifferInDest = true
+
+	extractor := newExtractor(f, pkg)
+	for _, name := range o.interfaces {
+		if err := extractor.ExtractInterface(name); err != nil {
+			return nil, fmt.Errorf("error while extracting interface: %w", err)
+		}
+	}
+	if err := o.apply(f); err != nil {
+		return nil, err
 	}
-	visitor := newVisitor(&f, nodes.Imports)
-	astutil.Apply(nodes, nil, visitor.Visit)
-	if visitor.err != nil {
-		return nil, fmt.Errorf("error while visiting AST: %w", visitor.err)
+	if err := checkOptionals(f, pkg, destDir); err != nil {
+		return nil, err
+	}
+	if err := checkDuplicates(f, dest); err != nil {
+		return nil, err
+	}
+	o.decorated(f.Targets())
+	return execute(f, dest)
+}
+
+// parseFile parses the file at path, or src if not nil, with its comments.
+// Syntax errors are returned as Diagnostics.
+func parseFile(fset *token.FileSet, path string, src any) (*ast.File, error) {
+	file, err := parser.ParseFile(fset, path, src, parser.ParseComments)
+	if list, ok := err.(scanner.ErrorList); ok {
+		errs := make([]error, 0, len(list))
+		for _, e := range list {
+			errs = append(errs, &Diagnostic{
+				Pos:     e.Pos,
+				Message: e.Msg,
+			})
+		}
+		return nil, errors.Join(errs...)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse file %s: %w", path, err)
 	}
+	return file, nil
+}
 
+func newFile(version, packageName string, o *options) *File {
+	f := &File{
+		Version:      version,
+		PackageName:  packageName,
+		Explicit:     o.explicit,
+		Streams:      o.streams,
+		Panics:       o.panics,
+		ChildContext: o.childContext,
+		Imports: map[string]Package{
+			"os": {
+				Path: "os",
+			},
+			"strings": {
+				Path: "strings",
+			},
+			"newrelic": {
+				Path: "github.com/newrelic/go-agent/v3/newrelic",
+			},
+		},
+	}
+	if o.panics {
+		f.Imports["fmt"] = Package{
+			Path: "fmt",
+		}
+	}
+	if o.childContext {
+		f.Imports["nrdeco"] = Package{
+			Path: "github.com/miyamo2/nrdeco",
+		}
+	}
+	return f
+}
+
+// execute renders the file and formats the result as goimports does.
+func execute(f *File, dest string) ([]byte, error) {
+	tpl, err := parseTemplate()
+	if err != nil {
+		return nil, err
+	}
 	var buf bytes.Buffer
-	err = tpl.Execute(&buf, &f)
+	err = tpl.Execute(&buf, f)
 	if err != nil {
 		return nil, err
 	}
-	return buf.Bytes(), nil
+	b, err := imports.Process(dest, buf.Bytes(), &imports.Options{
+		Comments:  true,
+		TabIndent: true,
+		TabWidth:  8,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to format generated code: %w", err)
+	}
+	return b, nil
 }
 
 // Visitor visits each *astutil.Cursor to find interfaces and their methods
 type Visitor struct {
 	f               *File
+	fset            *token.FileSet
 	importSpecs     []*ast.ImportSpec
 	importPathCache map[string]string
-	err             error
+	// selected reports whether the interface named name is to be decorated.
+	selected func(name string) bool
+	// diagnostics are the problems found while visiting.
+	// A problem in a method skips the method, so that those in the others are reported at once.
+	diagnostics []error
 }
 
 func (v *Visitor) Visit(c *astutil.Cursor) bool {
@@ -110,10 +273,19 @@ func (v *Visitor) Visit(c *astutil.Cursor) bool {
 	if !ok {
 		return true
 	}
+	if funcType, ok := typeSpec.Type.(*ast.FuncType); ok {
+		doc := typeSpec.Doc
+		if genDecl, ok := c.Parent().(*ast.GenDecl); ok && doc == nil {
+			doc = genDecl.Doc
+		}
+		v.visitFunc(typeSpec, funcType, doc)
+		return true
+	}
 	interfaceType, ok := typeSpec.Type.(*ast.InterfaceType)
-	if !ok {
+	if !ok || !v.selected(typeSpec.Name.Name) {
 		return true
 	}
+	start := len(v.diagnostics)
 	t := Interface{
 		Name:    typeSpec.Name.Name,
 		Methods: make([]Method, 0, len(interfaceType.Methods.List)),
@@ -123,38 +295,91 @@ func (v *Visitor) Visit(c *astutil.Cursor) bool {
 		if !ok {
 			continue
 		}
-		method := Method{
-			Name:    field.Names[0].Name,
-			Params:  make([]Value, 0, len(funcType.Params.List)),
-			Returns: make([]Value, 0, len(funcType.Results.List)),
+		reported := len(v.diagnostics)
+		params, err := v.valuesFromFields(funcType.Params)
+		if err != nil {
+			v.diagnostics = append(v.diagnostics, err)
+			continue
 		}
-		for _, param := range funcType.Params.List {
-			val, err := v.valueFromExpr(param.Type)
-			if err != nil {
-				v.err = err
-				return false
-			}
-			method.Params = append(method.Params, *val)
+		rets, err := v.valuesFromFields(funcType.Results)
+		if err != nil {
+			v.diagnostics = append(v.diagnostics, err)
+			continue
 		}
-		for _, result := range funcType.Results.List {
-			val, err := v.valueFromExpr(result.Type)
-			if err != nil {
-				v.err = err
-				return false
-			}
-			method.Returns = append(method.Returns, *val)
+		method := Method{
+			Name:    field.Names[0].Name,
+			Async:   hasDirective(field.Doc, directiveAsync),
+			Params:  params,
+			Returns: rets,
 		}
+		t.Declared = append(t.Declared, method)
 		if !method.Params.BeGenerated() {
+			// The signature of a method which is not instrumented is not emitted.
+			v.diagnostics = v.diagnostics[:reported]
 			continue
 		}
 		t.Methods = append(t.Methods, method)
 	}
-	if len(t.Methods) != 0 {
-		v.f.Interfaces = append(v.f.Interfaces, t)
+	if len(t.Methods) > 0 && v.f.DifferInDest && !typeSpec.Name.IsExported() {
+		v.diagnostics = slices.Insert(v.diagnostics, start, error(v.errorf(
+			typeSpec.Name.Pos(),
+			"unexported interface '%s' cannot be referred from package %s",
+			typeSpec.Name.Name,
+			v.f.PackageName,
+		)))
+		return true
 	}
+	v.f.Interfaces = append(v.f.Interfaces, t)
 	return true
 }
 
+// visitFunc appends the function type declared by typeSpec to the file if it accepts context.Context.
+// Generic function types and aliases are ignored.
+func (v *Visitor) visitFunc(typeSpec *ast.TypeSpec, funcType *ast.FuncType, doc *ast.CommentGroup) {
+	if typeSpec.TypeParams != nil || typeSpec.Assign.IsValid() || !v.selected(typeSpec.Name.Name) {
+		return
+	}
+	reported := len(v.diagnostics)
+	params, err := v.valuesFromFields(funcType.Params)
+	if err != nil {
+		v.diagnostics = append(v.diagnostics, err)
+		return
+	}
+	rets, err := v.valuesFromFields(funcType.Results)
+	if err != nil {
+		v.diagnostics = append(v.diagnostics, err)
+		return
+	}
+	method := Method{
+		Name:    typeSpec.Name.Name,
+		Async:   hasDirective(doc, directiveAsync),
+		Params:  params,
+		Returns: rets,
+	}
+	t := Interface{
+		Name:     typeSpec.Name.Name,
+		Declared: []Method{method},
+		Function: true,
+	}
+	if !method.Params.BeGenerated() {
+		// The signature of a function type which is not decorated is not emitted.
+		v.diagnostics = v.diagnostics[:reported]
+		v.f.Interfaces = append(v.f.Interfaces, t)
+		return
+	}
+	if v.f.DifferInDest && !typeSpec.Name.IsExported() {
+		v.diagnostics = slices.Insert(v.diagnostics, reported, error(v.errorf(
+			typeSpec.Name.Pos(),
+			"unexported function type '%s' cannot be referred from package %s",
+			typeSpec.Name.Name,
+			v.f.PackageName,
+		)))
+		return
+	}
+	t.Methods = []Method{method}
+	v.f.Interfaces = append(v.f.Interfaces, t)
+}
+
 func (v *Visitor) getImportPath(pkg string) string {
 	if p, ok := v.f.Imports[pkg]; ok {
 		return p.Path
@@ -168,6 +393,17 @@ func (v *Visitor) getImportPath(pkg string) string {
 
 	if importIdx == -1 {
 		importIdx = slices.IndexFunc(v.importSpecs, func(importSpec *ast.ImportSpec) bool {
+			if importSpec.Name != nil {
+				return false
+			}
+			return importName(strings.Trim(importSpec.Path.Value, `"`)) == pkg
+		})
+	}
+	if importIdx == -1 {
+		importIdx = slices.IndexFunc(v.importSpecs, func(importSpec *ast.ImportSpec) bool {
+			if importSpec.Name != nil {
+				return false
+			}
 			return strings.HasSuffix(importSpec.Path.Value, fmt.Sprintf(`%s"`, pkg))
 		})
 	}
@@ -193,6 +429,13 @@ func (v *Visitor) valueFromExpr(t ast.Expr) (*Value, error) {
 		if err != nil {
 			return nil, err
 		}
+		if t.Len != nil {
+			return &Value{
+				Type:    typeArray,
+				Len:     v.lenFromExpr(t.Len),
+				Element: element,
+			}, nil
+		}
 		return &Value{
 			Type:    typeSlice,
 			Element: element,
@@ -208,7 +451,7 @@ func (v *Visitor) valueFromExpr(t ast.Expr) (*Value, error) {
 		}
 		return &Value{
 			Type:    typeMap,
-			Key:     k.Type,
+			Key:     k,
 			Element: v,
 		}, nil
 	case *ast.StarExpr:
@@ -242,23 +485,13 @@ func (v *Visitor) valueFromExpr(t ast.Expr) (*Value, error) {
 			Element: el,
 		}, nil
 	case *ast.FuncType:
-		params := make(Params, 0, len(t.Params.List))
-		for _, field := range t.Params.List {
-			for _, p := range field.Names {
-				val, err := v.valueFromExpr(p)
-				if err != nil {
-					return nil, err
-				}
-				params = append(params, *val)
-			}
+		params, err := v.valuesFromFields(t.Params)
+		if err != nil {
+			return nil, err
 		}
-		rets := make(Returns, 0, len(t.Results.List))
-		for _, field := range t.Results.List {
-			val, err := v.valueFromExpr(field.Type)
-			if err != nil {
-				return nil, err
-			}
-			rets = append(rets, *val)
+		rets, err := v.valuesFromFields(t.Results)
+		if err != nil {
+			return nil, err
 		}
 		return &Value{
 			Type:    typeFunction,
@@ -266,33 +499,101 @@ func (v *Visitor) valueFromExpr(t ast.Expr) (*Value, error) {
 			Returns: rets,
 		}, nil
 	case *ast.Ident:
-		if v.f.DifferInDest && unicode.IsUpper(rune(t.Name[0])) {
+		if v.f.DifferInDest && !t.IsExported() && types.Universe.Lookup(t.Name) == nil {
+			v.report(
+				t.Pos(),
+				"unexported type '%s' cannot be referred from package %s",
+				t.Name,
+				v.f.PackageName,
+			)
+		}
+		if v.f.DifferInDest && t.IsExported() {
 			// If an identifier begins with an uppercase letter,
 			// it is assumed to be of the type defined in the original package.
 			importPath := v.getImportPath(v.f.OriginalPackageName)
 			if importPath == "" {
-				return nil, fmt.Errorf("import '%s' not found", t.Name)
+				return nil, v.errorf(
+					t.Pos(),
+					"import of package %s not found",
+					v.f.OriginalPackageName,
+				)
 			}
 			return &Value{
-				Type:    t.Name,
-				Package: &Package{Path: importPath},
+				Type: t.Name,
+				Package: &Package{
+					Path: importPath,
+					Name: v.f.OriginalPackageName,
+				},
 			}, nil
 		}
 		return &Value{
 			Type: t.Name,
 		}, nil
 	case *ast.SelectorExpr:
-		pkgName := t.X.(*ast.Ident).Name
+		x, ok := t.X.(*ast.Ident)
+		if !ok {
+			return nil, v.errorf(t.Pos(), "unsupported type expression %s", types.ExprString(t))
+		}
+		pkgName := x.Name
 		importPath := v.getImportPath(pkgName)
 		if importPath == "" {
-			return nil, fmt.Errorf("import '%s' not found", pkgName)
+			return nil, v.errorf(t.Pos(), "import '%s' not found", pkgName)
 		}
 		return &Value{
 			Type: t.Sel.Name,
 			Package: &Package{
 				Path: importPath,
+				Name: pkgName,
 			},
 		}, nil
+	case *ast.IndexExpr:
+		return v.instantiate(t.X, t.Index)
+	case *ast.IndexListExpr:
+		return v.instantiate(t.X, t.Indices...)
+	case *ast.ParenExpr:
+		return v.valueFromExpr(t.X)
+	case *ast.StructType:
+		fields := make([]Value, 0, t.Fields.NumFields())
+		for _, field := range t.Fields.List {
+			val, err := v.valueFromExpr(field.Type)
+			if err != nil {
+				return nil, err
+			}
+			if field.Tag != nil {
+				val.Tag = field.Tag.Value
+			}
+			if len(field.Names) == 0 {
+				fields = append(fields, *val)
+				continue
+			}
+			for _, name := range field.Names {
+				v.checkExported(name, "field")
+				named := *val
+				named.Name = name.Name
+				fields = append(fields, named)
+			}
+		}
+		return &Value{
+			Type:   typeStruct,
+			Fields: fields,
+		}, nil
+	case *ast.InterfaceType:
+		fields := make([]Value, 0, t.Methods.NumFields())
+		for _, field := range t.Methods.List {
+			val, err := v.valueFromExpr(field.Type)
+			if err != nil {
+				return nil, err
+			}
+			if len(field.Names) > 0 {
+				v.checkExported(field.Names[0], "method")
+				val.Name = field.Names[0].Name
+			}
+			fields = append(fields, *val)
+		}
+		return &Value{
+			Type:   typeInterface,
+			Fields: fields,
+		}, nil
 	case *ast.Ellipsis:
 		el, err := v.valueFromExpr(t.Elt)
 		if err != nil {
@@ -303,15 +604,120 @@ func (v *Visitor) valueFromExpr(t ast.Expr) (*Value, error) {
 			Element: el,
 		}, nil
 	default:
-		return nil, fmt.Errorf("unsupported type expression: %T", t)
+		return nil, v.errorf(t.Pos(), "unsupported type expression %s", types.ExprString(t))
+	}
+}
+
+// valuesFromFields returns a value per parameter or result in fields, naming it after the field if it is named.
+// Grouped fields such as "a, b string" result in a value for each name.
+func (v *Visitor) valuesFromFields(fields *ast.FieldList) ([]Value, error) {
+	values := make([]Value, 0, fields.NumFields())
+	if fields == nil {
+		return values, nil
+	}
+	for _, field := range fields.List {
+		val, err := v.valueFromExpr(field.Type)
+		if err != nil {
+			return nil, err
+		}
+		if len(field.Names) == 0 {
+			values = append(values, *val)
+			continue
+		}
+		for _, name := range field.Names {
+			named := *val
+			named.Name = name.Name
+			values = append(values, named)
+		}
+	}
+	return values, nil
+}
+
+// checkExported reports name of a field or a method of an anonymous type if it is unexported
+// and the file is generated in a different destination,
+// since such a type declared in the original package is not identical to the one in the generated code.
+func (v *Visitor) checkExported(name *ast.Ident, kind string) {
+	if !v.f.DifferInDest || name.IsExported() || name.Name == "_" {
+		return
+	}
+	v.report(
+		name.Pos(),
+		"anonymous type with unexported %s '%s' cannot be referred from package %s",
+		kind,
+		name.Name,
+		v.f.PackageName,
+	)
+}
+
+// report records a problem at pos and lets the visitor continue.
+func (v *Visitor) report(pos token.Pos, format string, args ...any) {
+	v.diagnostics = append(v.diagnostics, v.errorf(pos, format, args...))
+}
+
+// errorf returns a Diagnostic at pos.
+func (v *Visitor) errorf(pos token.Pos, format string, args ...any) *Diagnostic {
+	return &Diagnostic{
+		Pos:     positionOf(v.fset, pos),
+		Message: fmt.Sprintf(format, args...),
+	}
+}
+
+// lenFromExpr returns the length of an array type as written in the source,
+// qualifying the constants of the original package if the file is generated in a different destination.
+func (v *Visitor) lenFromExpr(x ast.Expr) string {
+	s := types.ExprString(x)
+	if !v.f.DifferInDest {
+		return s
+	}
+	// Parse the expression again so as not to modify the AST of the source.
+	x, err := parser.ParseExpr(s)
+	if err != nil {
+		return s
+	}
+	qualified := astutil.Apply(x, func(c *astutil.Cursor) bool {
+		if _, ok := c.Node().(*ast.SelectorExpr); ok {
+			return false
+		}
+		if ident, ok := c.Node().(*ast.Ident); ok && ident.IsExported() {
+			v.getImportPath(v.f.OriginalPackageName)
+			c.Replace(&ast.SelectorExpr{
+				X:   ast.NewIdent(v.f.OriginalPackageName),
+				Sel: ident,
+			})
+		}
+		return true
+	}, nil)
+	return types.ExprString(qualified.(ast.Expr))
+}
+
+// instantiate returns the value of the generic type x instantiated with indices.
+func (v *Visitor) instantiate(x ast.Expr, indices ...ast.Expr) (*Value, error) {
+	val, err := v.valueFromExpr(x)
+	if err != nil {
+		return nil, err
+	}
+	for _, index := range indices {
+		arg, err := v.valueFromExpr(index)
+		if err != nil {
+			return nil, err
+		}
+		val.TypeArgs = append(val.TypeArgs, *arg)
 	}
+	return val, nil
 }
 
-func newVisitor(f *File, importSpecs []*ast.ImportSpec) *Visitor {
+func newVisitor(
+	f *File,
+	fset *token.FileSet,
+	importSpecs []*ast.ImportSpec,
+	selected func(name string) bool,
+) *Visitor {
 	return &Visitor{
 		f:               f,
+		fset:            fset,
 		importSpecs:     importSpecs,
 		importPathCache: make(map[string]string),
+		selected:        selected,
 	}
 }
 
@@ -0,0 +1,112 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"testing"
+)
+
+func TestGenerateTypes(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		dest   string
+		want   []string
+	}{
+		{
+			name:   "grouped parameters",
+			method: "Get(ctx context.Context, a, b string) error",
+			want: []string{
+				"Get(ctx context.Context, arg1 string, arg2 string) error {",
+				"return n.Store.Get(ctx, arg1, arg2)",
+			},
+		},
+		{
+			name:   "array lengths",
+			method: "Get(ctx context.Context, a [N]byte, b [N * 2]byte) error",
+			want: []string{
+				"Get(ctx context.Context, arg1 [N]byte, arg2 [N * 2]byte) error {",
+			},
+		},
+		{
+			name:   "array lengths in a different package",
+			method: "Get(ctx context.Context, a [N]byte, b [N * 2]byte) error",
+			dest:   "decorated/store.go",
+			want: []string{
+				"Get(ctx context.Context, arg1 [store.N]byte, " +
+					"arg2 [store.N * 2]byte) error {",
+			},
+		},
+		{
+			name: "composite map keys",
+			method: "Get(ctx context.Context, a map[[2]int]string, " +
+				"b map[struct{ A int }]bool) error",
+			want: []string{
+				"Get(ctx context.Context, arg1 map[[2]int]string, " +
+					"arg2 map[struct{ A int }]bool) error {",
+			},
+		},
+		{
+			name: "function types",
+			method: "Get(ctx context.Context, f func(a int, b string) error, " +
+				"g func(int, ...string) (int, error)) error",
+			want: []string{
+				"Get(ctx context.Context, arg1 func(a int, b string) error, " +
+					"arg2 func(int, ...string) (int, error)) error {",
+			},
+		},
+		{
+			name: "anonymous struct and interface types",
+			method: "Get(ctx context.Context, " +
+				"s struct {\n\t\tA int\n\t\tB string `json:\"b\"`\n\t}, i interface{ M() }) error",
+			want: []string{
+				"Get(ctx context.Context, arg1 struct {\n\tA int\n\tB string `json:\"b\"`\n}, " +
+					"arg2 interface{ M() }) error {",
+			},
+		},
+		{
+			name:   "parenthesized types",
+			method: "Get(ctx context.Context, p *(int), s [](string)) error",
+			want: []string{
+				"Get(ctx context.Context, arg1 *int, arg2 []string) error {",
+			},
+		},
+		{
+			name:   "named results",
+			method: "Get(ctx context.Context) (n int, err error)",
+			want: []string{
+				"Get(ctx context.Context) (int, error) {",
+				"return n.Store.Get(ctx)",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			writeFiles(t, root, map[string]string{
+				"go.mod": "module example.com/m\n\ngo 1.24\n",
+				"store/store.go": "package store\n\nimport \"context\"\n\nconst N = 4\n\n" +
+					"type Store interface {\n\t" + tt.method + "\n}\n",
+			})
+			dest := "store/store.nrdeco.go"
+			if tt.dest != "" {
+				dest = tt.dest
+			}
+			got, err := Generate(
+				context.Background(),
+				filepath.Join(root, "store", "store.go"),
+				filepath.Join(root, filepath.FromSlash(dest)),
+				"test",
+			)
+			if err != nil {
+				t.Fatalf("Generate() failed: %v", err)
+			}
+			for _, want := range tt.want {
+				if !bytes.Contains(got, []byte(want)) {
+					t.Errorf("Generate() does not contain %q:\n%s", want, got)
+				}
+			}
+		})
+	}
+}
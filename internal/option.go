@@ -0,0 +1,259 @@
+package internal
+
+import (
+	"fmt"
+	"slices"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// Option configures the behavior of Generate.
+type Option func(*options)
+
+type options struct {
+	types        []string
+	interfaces   []string
+	segment      string
+	methods      map[string]MethodConfig
+	destPackage  string
+	explicit     bool
+	optionals    map[string][]string
+	streams      bool
+	panics       bool
+	childContext bool
+	prefix       string
+	suffix       string
+	typeName     string
+	line         int
+	packageName  string
+	warn         func(msg string)
+	decorated    func(types []string)
+}
+
+// WithTypes makes Generate extract interfaces from the given struct types
+// instead of decorating the interfaces declared in the source file.
+func WithTypes(names ...string) Option {
+	return func(o *options) {
+		o.types = append(o.types, names...)
+	}
+}
+
+// WithInterfaces specifies the interfaces to be decorated.
+// Generate ignores the other interfaces declared in the source file.
+func WithInterfaces(names ...string) Option {
+	return func(o *options) {
+		o.interfaces = append(o.interfaces, names...)
+	}
+}
+
+// WithSegment specifies the template of the segment names. See SegmentData for the available fields.
+func WithSegment(tmpl string) Option {
+	return func(o *options) {
+		o.segment = tmpl
+	}
+}
+
+// WithMethods overrides the behavior per method, keyed by "<Interface>.<Method>".
+func WithMethods(methods map[string]MethodConfig) Option {
+	return func(o *options) {
+		o.methods = methods
+	}
+}
+
+// WithDestPackage overrides the name of the package of the generated code.
+func WithDestPackage(name string) Option {
+	return func(o *options) {
+		o.destPackage = name
+	}
+}
+
+// WithLine specifies the line of the go:generate directive in the source file, as given by $GOLINE.
+// If the directive is directly above an interface or function type, possibly among the lines of its doc comment,
+// Generate decorates only that type.
+func WithLine(line int) Option {
+	return func(o *options) {
+		o.line = line
+	}
+}
+
+// WithPackageName specifies the name of the package of the source file, as given by $GOPACKAGE,
+// so that Generate loads the external test package if the name ends with _test.
+func WithPackageName(name string) Option {
+	return func(o *options) {
+		o.packageName = name
+	}
+}
+
+// WithExplicit makes the decorators delegate every method explicitly to an unexported field
+// instead of embedding the interface.
+func WithExplicit() Option {
+	return func(o *options) {
+		o.explicit = true
+	}
+}
+
+// WithOptionals specifies the optional interfaces to be retained by the decorator of the interface named name.
+// Each of them is either "<Name>" for a type in the original package or "<import path>.<Name>".
+func WithOptionals(name string, optionals ...string) Option {
+	return func(o *options) {
+		if o.optionals == nil {
+			o.optionals = make(map[string][]string)
+		}
+		o.optionals[name] = append(o.optionals[name], optionals...)
+	}
+}
+
+// WithStreams makes the segments of methods returning iterators or receive-only channels
+// last until the returned value is consumed or drained.
+func WithStreams() Option {
+	return func(o *options) {
+		o.streams = true
+	}
+}
+
+// WithPanics makes the decorators recover panics in the decorated methods,
+// notice them as errors on the transaction with their stack traces, end the segments and re-panic.
+func WithPanics() Option {
+	return func(o *options) {
+		o.panics = true
+	}
+}
+
+// WithChildContext makes the decorators call the decorated methods with a child context carrying the segment.
+// See nrdeco.FromContext.
+func WithChildContext() Option {
+	return func(o *options) {
+		o.childContext = true
+	}
+}
+
+// WithPrefix specifies the prefix of the decorator type names, which defaults to DefaultPrefix.
+func WithPrefix(prefix string) Option {
+	return func(o *options) {
+		o.prefix = prefix
+	}
+}
+
+// WithSuffix specifies the suffix of the decorator type names.
+func WithSuffix(suffix string) Option {
+	return func(o *options) {
+		o.suffix = suffix
+	}
+}
+
+// WithTypeNameTemplate specifies the template of the decorator type names, overriding the prefix and the suffix.
+// See TypeNameData for the available fields.
+func WithTypeNameTemplate(tmpl string) Option {
+	return func(o *options) {
+		o.typeName = tmpl
+	}
+}
+
+// WithWarn specifies the function called with warnings found while generating.
+func WithWarn(warn func(msg string)) Option {
+	return func(o *options) {
+		o.warn = warn
+	}
+}
+
+// WithDecorated specifies the function called with the types decorated by the generated code,
+// which are the interfaces and the function types, or the struct types given by WithTypes.
+func WithDecorated(decorated func(types []string)) Option {
+	return func(o *options) {
+		o.decorated = decorated
+	}
+}
+
+func newOptions(opts ...Option) *options {
+	o := &options{
+		segment:   DefaultSegment,
+		prefix:    DefaultPrefix,
+		warn:      func(string) {},
+		decorated: func([]string) {},
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// loadMode returns the packages.LoadMode required to load the package of the source file.
+func (o *options) loadMode() packages.LoadMode {
+	if len(o.types) == 0 && !o.explicit && len(o.optionals) == 0 {
+		return packages.NeedName
+	}
+	return typesLoadMode
+}
+
+// typesLoadMode is the packages.LoadMode to load packages with their type information.
+const typesLoadMode = packages.NeedName | packages.NeedTypes | packages.NeedSyntax |
+	packages.NeedTypesInfo | packages.NeedImports | packages.NeedDeps
+
+// apply applies the per-method overrides to the interfaces in f and names their decorators and segments.
+func (o *options) apply(f *File) error {
+	interfaces := make([]Interface, 0, len(f.Interfaces))
+	for _, t := range f.Interfaces {
+		t.Methods = slices.DeleteFunc(t.Methods, func(m Method) bool {
+			return o.methods[fmt.Sprintf("%s.%s", t.Target(), m.Name)].Skip
+		})
+		if len(t.Methods) == 0 {
+			continue
+		}
+		name, err := o.decoratorName(f, &t)
+		if err != nil {
+			return err
+		}
+		t.DecoratorName = name
+		for i := range t.Methods {
+			segment, err := o.segmentName(f, &t, &t.Methods[i])
+			if err != nil {
+				return err
+			}
+			t.Methods[i].Segment = segment
+			if o.methods[fmt.Sprintf("%s.%s", t.Target(), t.Methods[i].Name)].Async {
+				t.Methods[i].Async = true
+			}
+			if !o.streams && t.Methods[i].StreamIndex() >= 0 {
+				name := fmt.Sprintf("%s.%s", t.Target(), t.Methods[i].Name)
+				if t.Function {
+					name = t.Target()
+				}
+				o.warn(fmt.Sprintf(
+					"%s returns %s, but its segment ends before the value is consumed; enable streams (--streams) to extend it",
+					name,
+					t.Methods[i].Stream().StringOfType(),
+				))
+			}
+		}
+		optionals := o.optionals[t.Name]
+		if t.Function && len(optionals) > 0 {
+			return fmt.Errorf(
+				"optional interfaces cannot be retained by the decorator of function type %s",
+				t.Name,
+			)
+		}
+		if len(optionals) > maxOptionals {
+			return fmt.Errorf(
+				"too many optional interfaces for %s: %d > %d",
+				t.Name,
+				len(optionals),
+				maxOptionals,
+			)
+		}
+		for _, optional := range optionals {
+			val, err := optionalValue(f, optional)
+			if err != nil {
+				return err
+			}
+			t.Optionals = append(t.Optionals, *val)
+		}
+		interfaces = append(interfaces, t)
+	}
+	f.Interfaces = interfaces
+	return nil
+}
+
+// selected returns true if the interface named name is to be decorated, otherwise false.
+func (o *options) selected(name string) bool {
+	return len(o.interfaces) == 0 || slices.Contains(o.interfaces, name)
+}
@@ -0,0 +1,224 @@
+package internal
+
+import (
+	"fmt"
+	"go/types"
+	"strings"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// maxOptionals is the maximum number of optional interfaces per decorated interface,
+// since the number of generated combinations grows exponentially.
+const maxOptionals = 8
+
+// Combination represents a combination of the optional interfaces implemented by a decorated value.
+type Combination struct {
+	// Condition is the expression which is true if the decorated value implements exactly the combination.
+	Condition string
+	// Expr is the expression of the decorator implementing the combination.
+	Expr string
+}
+
+// Combinations returns every combination of the optional interfaces of the interface,
+// ending with the one that implements none of them, whose condition is empty.
+func (i *Interface) Combinations() []Combination {
+	n := len(i.Optionals)
+	combinations := make([]Combination, 0, 1<<n)
+	for mask := 1<<n - 1; mask >= 0; mask-- {
+		var (
+			conditions = make([]string, 0, n)
+			fields     = []string{fmt.Sprintf("*%s", i.DecoratorName)}
+			values     = []string{"n"}
+		)
+		for j, optional := range i.Optionals {
+			if mask&(1<<j) == 0 {
+				conditions = append(conditions, fmt.Sprintf("!ok%d", j))
+				continue
+			}
+			conditions = append(conditions, fmt.Sprintf("ok%d", j))
+			fields = append(fields, optional.StringOfType())
+			values = append(values, fmt.Sprintf("o%d", j))
+		}
+		c := Combination{
+			Expr: "n",
+		}
+		if mask != 0 {
+			c.Condition = strings.Join(conditions, " && ")
+		}
+		if len(fields) > 1 {
+			c.Expr = fmt.Sprintf(
+				"struct {\n%s\n}{%s}",
+				strings.Join(fields, "\n"),
+				strings.Join(values, ", "),
+			)
+		}
+		combinations = append(combinations, c)
+	}
+	return combinations
+}
+
+// optionalValue returns the value of the optional interface type expressed as s,
+// which is either "<Name>" for a type in the original package or "<import path>.<Name>".
+func optionalValue(f *File, s string) (*Value, error) {
+	idx := strings.LastIndex(s, ".")
+	if idx == -1 {
+		if !f.DifferInDest {
+			return &Value{
+				Type: s,
+			}, nil
+		}
+		return &Value{
+			Type: s,
+			Package: &Package{
+				Path: f.Imports[f.OriginalPackageName].Path,
+				Name: f.OriginalPackageName,
+			},
+		}, nil
+	}
+	importPath, name := s[:idx], s[idx+1:]
+	if importPath == "" || name == "" {
+		return nil, fmt.Errorf("invalid optional interface '%s'", s)
+	}
+	pkgName := importName(importPath)
+	for k, imported := range f.Imports {
+		if imported.Path == importPath {
+			pkgName = k
+			break
+		}
+	}
+	if imported, ok := f.Imports[pkgName]; ok && imported.Path != importPath {
+		return nil, fmt.Errorf(
+			"optional interface '%s' conflicts with the import of %s as %s",
+			s,
+			imported.Path,
+			pkgName,
+		)
+	}
+	f.Imports[pkgName] = Package{
+		Path: importPath,
+	}
+	return &Value{
+		Type: name,
+		Package: &Package{
+			Path: importPath,
+			Name: pkgName,
+		},
+	}, nil
+}
+
+// checkOptionals checks that the optional interfaces of the interfaces in f exist,
+// and that no two of the decorator retaining them and the optional interfaces
+// declare the same method or are embedded as fields of the same name,
+// since the selector would be ambiguous in the decorator retaining them.
+// pkg is the package of the decorated interfaces, and external packages are loaded from dir.
+func checkOptionals(f *File, pkg *packages.Package, dir string) error {
+	loaded := map[string]*types.Package{
+		pkg.PkgPath: pkg.Types,
+	}
+	for _, t := range f.Interfaces {
+		if len(t.Optionals) == 0 {
+			continue
+		}
+		obj, methods, err := decoratorMethods(t, pkg.Types)
+		if err != nil {
+			return err
+		}
+		errorf := func(format string, args ...any) error {
+			return &Diagnostic{
+				Pos:     positionOf(pkg.Fset, obj.Pos()),
+				Message: fmt.Sprintf(format, args...),
+			}
+		}
+		// owners maps the methods of the decorator retaining every optional interface
+		// to the decorator or the optional interface declaring them,
+		// and fields maps the names of its embedded fields to their types likewise.
+		owners := make(map[string]string, len(methods))
+		for _, m := range methods {
+			owners[m] = t.DecoratorName
+		}
+		fields := map[string]string{
+			t.DecoratorName: t.DecoratorName,
+		}
+		for _, optional := range t.Optionals {
+			name := optional.StringOfType()
+			path := pkg.PkgPath
+			if optional.Package != nil {
+				path = optional.Package.Path
+			}
+			if _, ok := loaded[path]; !ok {
+				pkgs, err := packages.Load(&packages.Config{Mode: typesLoadMode, Dir: dir}, path)
+				if err != nil {
+					return fmt.Errorf("failed to load package %s: %w", path, err)
+				}
+				if len(pkgs) != 1 || len(pkgs[0].Errors) > 0 || pkgs[0].Types == nil {
+					return errorf("package %s of optional interface '%s' not found", path, name)
+				}
+				loaded[path] = pkgs[0].Types
+			}
+			optionalObj, ok := loaded[path].Scope().Lookup(optional.Type).(*types.TypeName)
+			switch {
+			case !ok:
+				return errorf("optional interface '%s' of %s not found", name, t.Name)
+			case optional.Package != nil && !optionalObj.Exported():
+				return errorf("optional interface '%s' of %s is not exported", name, t.Name)
+			}
+			iface, ok := optionalObj.Type().Underlying().(*types.Interface)
+			if !ok {
+				return errorf("optional '%s' of %s is not an interface type", name, t.Name)
+			}
+			if other, ok := fields[optional.Type]; ok {
+				return errorf(
+					"optional interface '%s' of %s conflicts with %s embedded as %s",
+					name,
+					t.Name,
+					other,
+					optional.Type,
+				)
+			}
+			fields[optional.Type] = name
+			for fn := range iface.Methods() {
+				if other, ok := owners[fn.Name()]; ok {
+					return errorf(
+						"optional interface '%s' of %s conflicts with %s, since both declare %s",
+						name,
+						t.Name,
+						other,
+						fn.Name(),
+					)
+				}
+				owners[fn.Name()] = name
+			}
+		}
+	}
+	return nil
+}
+
+// decoratorMethods returns the object declaring t
+// and the names of the methods of the decorator of t, including Unwrap.
+func decoratorMethods(t Interface, pkg *types.Package) (types.Object, []string, error) {
+	methods := []string{"Unwrap"}
+	if t.Extracted() {
+		obj := pkg.Scope().Lookup(t.Struct)
+		if obj == nil {
+			return nil, nil, fmt.Errorf("type '%s' not found in package %s", t.Struct, pkg.Path())
+		}
+		// The extracted interface is not declared in pkg, but its methods are loaded with types.
+		for _, m := range t.Declared {
+			methods = append(methods, m.Name)
+		}
+		return obj, methods, nil
+	}
+	obj := pkg.Scope().Lookup(t.Name)
+	if obj == nil {
+		return nil, nil, fmt.Errorf("type '%s' not found in package %s", t.Name, pkg.Path())
+	}
+	iface, ok := obj.Type().Underlying().(*types.Interface)
+	if !ok {
+		return nil, nil, fmt.Errorf("'%s' is not an interface type", t.Name)
+	}
+	for fn := range iface.Methods() {
+		methods = append(methods, fn.Name())
+	}
+	return obj, methods, nil
+}
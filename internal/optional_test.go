@@ -0,0 +1,99 @@
+package internal
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGenerateOptionals(t *testing.T) {
+	files := map[string]string{
+		"go.mod": "module example.com/m\n\ngo 1.24\n",
+		"store/store.go": `package store
+
+import "context"
+
+type Obj interface {
+	Get(ctx context.Context, key string) (string, error)
+}
+
+type Store interface {
+	Get(ctx context.Context, key string) (string, error)
+	Close() error
+}
+
+type Stringer interface {
+	String() string
+}
+`,
+	}
+	tests := []struct {
+		name      string
+		iface     string
+		optionals []string
+		wantErr   string
+	}{
+		{
+			name:      "disjoint optional interfaces",
+			iface:     "Obj",
+			optionals: []string{"io.Closer", "fmt.Stringer"},
+		},
+		{
+			name:      "method of the decorated interface",
+			iface:     "Store",
+			optionals: []string{"io.Closer"},
+			wantErr:   "'io.Closer' of Store conflicts with NRStore, since both declare Close",
+		},
+		{
+			name:      "method shared by optional interfaces",
+			iface:     "Obj",
+			optionals: []string{"io.ReadCloser", "io.Closer"},
+			wantErr:   "'io.Closer' of Obj conflicts with io.ReadCloser, since both declare Close",
+		},
+		{
+			name:      "optional interfaces of the same name",
+			iface:     "Obj",
+			optionals: []string{"Stringer", "fmt.Stringer"},
+			wantErr:   "'fmt.Stringer' of Obj conflicts with Stringer embedded as Stringer",
+		},
+		{
+			name:      "missing optional interface",
+			iface:     "Obj",
+			optionals: []string{"Closer"},
+			wantErr:   "optional interface 'Closer' of Obj not found",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			writeFiles(t, root, files)
+			source := filepath.Join(root, "store", "store.go")
+			_, err := Generate(
+				context.Background(),
+				source,
+				filepath.Join(root, "store", "store.nrdeco.go"),
+				"test",
+				WithInterfaces(tt.iface),
+				WithOptionals(tt.iface, tt.optionals...),
+			)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Generate() failed: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("Generate() succeeded, want %q", tt.wantErr)
+			}
+			diagnostics := Diagnostics(err)
+			if len(diagnostics) != 1 || !strings.Contains(diagnostics[0].Message, tt.wantErr) {
+				t.Fatalf("Generate() failed with %v, want %q", err, tt.wantErr)
+			}
+			pos := diagnostics[0].Pos
+			if !pos.IsValid() || filepath.Base(pos.Filename) != "store.go" {
+				t.Errorf("Generate() reported the problem at %v, want a position in store.go", pos)
+			}
+		})
+	}
+}
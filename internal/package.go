@@ -0,0 +1,90 @@
+package internal
+
+import (
+	"go/parser"
+	"go/token"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"golang.org/x/tools/go/packages"
+)
+
+var (
+	majorVersion       = regexp.MustCompile(`^v[0-9]+$`)
+	majorVersionSuffix = regexp.MustCompile(`\.v[0-9]+$`)
+)
+
+// importName returns the name by which the package of importPath is referred to by convention,
+// skipping a major version suffix such as /v2 or .v3.
+func importName(importPath string) string {
+	name := path.Base(importPath)
+	if majorVersion.MatchString(name) {
+		name = path.Base(path.Dir(importPath))
+	}
+	return majorVersionSuffix.ReplaceAllString(name, "")
+}
+
+// packageNameOf returns the name of the package in dir.
+//
+// It is resolved in the following order:
+//
+//   - the name of the non-test package loaded from dir
+//   - the package clause of the first non-test file in dir, including those excluded by build constraints
+//   - the name derived from dir, skipping a major version suffix such as v2
+func packageNameOf(dir string) string {
+	pkgs, _ := packages.Load(&packages.Config{Mode: packages.NeedName, Dir: dir}, ".")
+	for _, pkg := range pkgs {
+		if pkg.Name != "" && !strings.HasSuffix(pkg.Name, "_test") {
+			return pkg.Name
+		}
+	}
+
+	entries, _ := os.ReadDir(dir)
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || filepath.Ext(name) != ".go" || strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		node, err := parser.ParseFile(
+			token.NewFileSet(),
+			filepath.Join(dir, name),
+			nil,
+			parser.PackageClauseOnly,
+		)
+		if err != nil || strings.HasSuffix(node.Name.Name, "_test") {
+			continue
+		}
+		return node.Name.Name
+	}
+
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		abs = dir
+	}
+	base := filepath.Base(abs)
+	if majorVersion.MatchString(base) {
+		base = filepath.Base(filepath.Dir(abs))
+	}
+	return sanitizePackageName(base)
+}
+
+// sanitizePackageName converts s into a valid package name by dropping characters not allowed in identifiers.
+func sanitizePackageName(s string) string {
+	name := strings.ToLower(strings.Map(func(r rune) rune {
+		if r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return r
+		}
+		return -1
+	}, s))
+	if name == "" {
+		return "main"
+	}
+	if unicode.IsDigit(rune(name[0])) {
+		return "_" + name
+	}
+	return name
+}
@@ -0,0 +1,182 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeFiles writes files, keyed by their slash-separated paths relative to root.
+func writeFiles(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestPackageNameOf(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		dir   string
+		want  string
+	}{
+		{
+			name: "loaded from the destination directory",
+			files: map[string]string{
+				"go.mod":         "module example.com/m\n\ngo 1.24\n",
+				"store/store.go": "package storage\n",
+			},
+			dir:  "store",
+			want: "storage",
+		},
+		{
+			name: "package clause of a file excluded by build constraints",
+			files: map[string]string{
+				"go.mod":          "module example.com/m\n\ngo 1.24\n",
+				"store/ignore.go": "//go:build ignore\n\npackage storage\n",
+			},
+			dir:  "store",
+			want: "storage",
+		},
+		{
+			name: "test files only",
+			files: map[string]string{
+				"go.mod":              "module example.com/m\n\ngo 1.24\n",
+				"store/store_test.go": "package store_test\n",
+			},
+			dir:  "store",
+			want: "store",
+		},
+		{
+			name: "major version directory",
+			files: map[string]string{
+				"go.mod": "module example.com/m\n\ngo 1.24\n",
+			},
+			dir:  "store/v2",
+			want: "store",
+		},
+		{
+			name: "hyphenated directory",
+			files: map[string]string{
+				"go.mod": "module example.com/m\n\ngo 1.24\n",
+			},
+			dir:  "user-store",
+			want: "userstore",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			writeFiles(t, root, tt.files)
+			dir := filepath.Join(root, filepath.FromSlash(tt.dir))
+			if got := packageNameOf(dir); got != tt.want {
+				t.Errorf("packageNameOf() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSanitizePackageName(t *testing.T) {
+	tests := []struct {
+		s    string
+		want string
+	}{
+		{s: "store", want: "store"},
+		{s: "user-store", want: "userstore"},
+		{s: "User.Store", want: "userstore"},
+		{s: "user_store", want: "user_store"},
+		{s: "2fa", want: "_2fa"},
+		{s: "---", want: "main"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			if got := sanitizePackageName(tt.s); got != tt.want {
+				t.Errorf("sanitizePackageName(%q) = %q, want %q", tt.s, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGenerateDestPackage(t *testing.T) {
+	files := map[string]string{
+		"go.mod": "module example.com/m\n\ngo 1.24\n",
+		"store/store.go": `package store
+
+import "context"
+
+type Store interface {
+	Get(ctx context.Context, key string) (string, error)
+}
+`,
+		"decorated/doc.go": "package decorated\n",
+	}
+	tests := []struct {
+		name        string
+		dest        string
+		destPackage string
+		want        string
+		wantErr     bool
+	}{
+		{
+			name: "detected from the destination directory",
+			dest: "decorated/store.go",
+			want: "package decorated\n",
+		},
+		{
+			name:        "overridden in a different directory",
+			dest:        "decorated/store.go",
+			destPackage: "tracing",
+			want:        "package tracing\n",
+		},
+		{
+			name:        "same as the source package",
+			dest:        "store/store.nrdeco.go",
+			destPackage: "store",
+			want:        "package store\n",
+		},
+		{
+			name:        "different from the source package in the same directory",
+			dest:        "store/store.nrdeco.go",
+			destPackage: "tracing",
+			wantErr:     true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			writeFiles(t, root, files)
+			var opts []Option
+			if tt.destPackage != "" {
+				opts = append(opts, WithDestPackage(tt.destPackage))
+			}
+			got, err := Generate(
+				context.Background(),
+				filepath.Join(root, "store", "store.go"),
+				filepath.Join(root, filepath.FromSlash(tt.dest)),
+				"test",
+				opts...,
+			)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("Generate() succeeded, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Generate() failed: %v", err)
+			}
+			if !bytes.Contains(got, []byte(tt.want)) {
+				t.Errorf("Generate() does not contain %q:\n%s", tt.want, got)
+			}
+		})
+	}
+}
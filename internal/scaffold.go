@@ -0,0 +1,217 @@
+package internal
+
+import (
+	"bytes"
+	"cmp"
+	_ "embed"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/template"
+
+	"golang.org/x/mod/modfile"
+	"golang.org/x/tools/imports"
+)
+
+// ToolPath is the import path of the nrdeco command, which is run by the go:generate directives as a tool.
+const ToolPath = "github.com/miyamo2/nrdeco/cmd/nrdeco"
+
+// GenerateDirective is the go:generate directive inserted by InsertDirective.
+const GenerateDirective = "//go:generate go tool nrdeco"
+
+// ConfigTemplate is the configuration file written by nrdeco init.
+const ConfigTemplate = "" +
+	"# Configuration of nrdeco. See https://github.com/miyamo2/nrdeco#configuration-file\n" +
+	"backend: " + BackendNewRelic + "\n" +
+	"segment: \"" + DefaultSegment + "\"\n"
+
+// InsertDirective returns the source of the file at path
+// with GenerateDirective inserted right above the package clause,
+// or the source as is if it already has a go:generate directive running nrdeco.
+func InsertDirective(path string) ([]byte, error) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	fset := token.NewFileSet()
+	file, err := parseFile(fset, path, src)
+	if err != nil {
+		return nil, err
+	}
+	if hasGenerateDirective(file) {
+		return src, nil
+	}
+	offset := fset.Position(file.Package).Offset
+	return slices.Concat(src[:offset], []byte(GenerateDirective+"\n"), src[offset:]), nil
+}
+
+// hasGenerateDirective returns true if file has a go:generate directive running nrdeco, otherwise false.
+func hasGenerateDirective(file *ast.File) bool {
+	for _, group := range file.Comments {
+		for _, c := range group.List {
+			command, ok := strings.CutPrefix(c.Text, "//go:generate ")
+			if !ok {
+				continue
+			}
+			for _, field := range strings.Fields(command) {
+				name, _, _ := strings.Cut(field, "@")
+				if name == "nrdeco" || strings.HasSuffix(name, "/nrdeco") {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// HasTool returns true if the go.mod at path declares nrdeco as a tool, otherwise false.
+func HasTool(path string) (bool, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return false, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	f, err := modfile.Parse(path, b, nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return slices.ContainsFunc(f.Tool, func(tool *modfile.Tool) bool {
+		return tool.Path == ToolPath
+	}), nil
+}
+
+// FindModule returns the path of the go.mod found from dir up to the root, or empty if there is none.
+func FindModule(dir string) (string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", fmt.Errorf("failed to get absolute path of %s: %w", dir, err)
+	}
+	for {
+		p := filepath.Join(dir, "go.mod")
+		if _, err := os.Stat(p); err == nil {
+			return p, nil
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", nil
+		}
+		dir = parent
+	}
+}
+
+//go:embed wiring.tmpl
+var wiringTemplate string
+
+// WiringSource is a file whose decorators are wired by Wiring.
+type WiringSource struct {
+	// Package is the package of the file.
+	Package Package
+	// Dir is the directory of the file.
+	Dir string
+	// File holds the decorated interfaces, as returned by Decorated.
+	File *File
+}
+
+// wiring is the data applied to wiring.tmpl.
+type wiring struct {
+	PackageName string
+	Imports     map[string]Package
+	Providers   []*provider
+}
+
+// provider is a function providing a decorated value.
+type provider struct {
+	Name      string
+	Qualifier string
+	Interface Interface
+	Explicit  bool
+}
+
+// StringOfImports returns the import specs of the packages.
+func (w *wiring) StringOfImports() string {
+	f := File{Imports: w.Imports}
+	return f.StringOfImports()
+}
+
+// Wiring returns the source of a file to be written to dest providing the values decorated by the exported decorators
+// in sources, each of which is a function accepting the value to be decorated, so that they can be wired by hand
+// or by a DI container.
+func Wiring(dest string, sources []WiringSource) ([]byte, error) {
+	absDest, err := filepath.Abs(dest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get absolute path of %s: %w", dest, err)
+	}
+	destDir := filepath.Dir(absDest)
+	w := wiring{
+		PackageName: packageNameOf(destDir),
+		Imports:     make(map[string]Package),
+	}
+	names := make(map[string]int)
+	for _, source := range sources {
+		dir, err := filepath.Abs(source.Dir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get absolute path of %s: %w", source.Dir, err)
+		}
+		qualifier := ""
+		if dir != destDir {
+			qualifier = w.importAs(source.Package) + "."
+		}
+		for _, t := range source.File.Interfaces {
+			if !token.IsExported(t.DecoratorName) || !token.IsExported(t.Name) {
+				continue
+			}
+			w.Providers = append(w.Providers, &provider{
+				Name:      "Provide" + t.DecoratorName,
+				Qualifier: qualifier,
+				Interface: t,
+				Explicit:  source.File.Explicit,
+			})
+			names["Provide"+t.DecoratorName]++
+		}
+	}
+	for _, p := range w.Providers {
+		if names[p.Name] > 1 && p.Qualifier != "" {
+			qualifier := upperFirst(strings.TrimSuffix(p.Qualifier, "."))
+			p.Name = "Provide" + qualifier + p.Interface.DecoratorName
+		}
+	}
+
+	tpl, err := template.New("wiring").Parse(wiringTemplate)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := tpl.Execute(&buf, &w); err != nil {
+		return nil, err
+	}
+	b, err := imports.Process(dest, buf.Bytes(), &imports.Options{
+		Comments:  true,
+		TabIndent: true,
+		TabWidth:  8,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to format wiring: %w", err)
+	}
+	return b, nil
+}
+
+// importAs adds pkg to the imports, renamed if its name is already taken by another package,
+// and returns the name by which it is referred to.
+func (w *wiring) importAs(pkg Package) string {
+	base := cmp.Or(pkg.Name, importName(pkg.Path))
+	name := base
+	for i := 2; ; i++ {
+		imported, ok := w.Imports[name]
+		if !ok || imported.Path == pkg.Path {
+			break
+		}
+		name = fmt.Sprintf("%s%d", base, i)
+	}
+	w.Imports[name] = Package{
+		Path: pkg.Path,
+	}
+	return name
+}
@@ -0,0 +1,57 @@
+package internal
+
+import (
+	"bytes"
+	"fmt"
+	"text/template"
+)
+
+// DefaultSegment is the default template of the segment names.
+const DefaultSegment = "{{ .Package }}.{{ .Type }}.{{ .Method }}"
+
+// DefaultFunctionSegment is the template of the segment names of function types used instead of DefaultSegment.
+const DefaultFunctionSegment = "{{ .Package }}.{{ .Type }}"
+
+// SegmentData is the data applied to the templates of the segment names.
+type SegmentData struct {
+	// Package is the name of the package of the generated code.
+	Package string
+	// Type is the name of the decorated type.
+	Type string
+	// Method is the name of the method. It is empty for function types.
+	Method string
+}
+
+func parseSegmentTemplate(s string) (*template.Template, error) {
+	return template.New("segment").Option("missingkey=error").Parse(s)
+}
+
+// segmentName returns the segment name of method m of t.
+func (o *options) segmentName(f *File, t *Interface, m *Method) (string, error) {
+	tmpl := o.segment
+	key := fmt.Sprintf("%s.%s", t.Target(), m.Name)
+	if override, ok := o.methods[key]; ok && override.Segment != "" {
+		tmpl = override.Segment
+	}
+	data := SegmentData{
+		Package: f.PackageName,
+		Type:    t.Target(),
+		Method:  m.Name,
+	}
+	if t.Function {
+		data.Method = ""
+		if tmpl == DefaultSegment {
+			tmpl = DefaultFunctionSegment
+		}
+	}
+	tpl, err := parseSegmentTemplate(tmpl)
+	if err != nil {
+		return "", fmt.Errorf("invalid segment template '%s': %w", tmpl, err)
+	}
+	var buf bytes.Buffer
+	err = tpl.Execute(&buf, data)
+	if err != nil {
+		return "", fmt.Errorf("failed to execute segment template '%s': %w", tmpl, err)
+	}
+	return buf.String(), nil
+}
@@ -0,0 +1,49 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// TypeCheck type-checks the package in the directory of dest as if generated were written to dest.
+// It returns every error reported by the type checker as a Diagnostic.
+func TypeCheck(dest string, generated []byte) error {
+	absDest, err := filepath.Abs(dest)
+	if err != nil {
+		return fmt.Errorf("failed to get absolute path of destination file %s: %w", dest, err)
+	}
+	// The destination directory may not exist yet, so the package is loaded from its nearest existing ancestor.
+	destDir := filepath.Dir(absDest)
+	dir := destDir
+	for {
+		if _, err := os.Stat(dir); err == nil || filepath.Dir(dir) == dir {
+			break
+		}
+		dir = filepath.Dir(dir)
+	}
+	rel, err := filepath.Rel(dir, destDir)
+	if err != nil {
+		return fmt.Errorf("failed to get relative path of %s: %w", destDir, err)
+	}
+	pkgs, err := packages.Load(&packages.Config{
+		Mode: typesLoadMode,
+		Dir:  dir,
+		Overlay: map[string][]byte{
+			absDest: generated,
+		},
+	}, "./"+filepath.ToSlash(rel))
+	if err != nil {
+		return fmt.Errorf("failed to load packages: %w", err)
+	}
+	var errs []error
+	for _, pkg := range pkgs {
+		for _, pkgErr := range pkg.Errors {
+			errs = append(errs, diagnosticFromPackageError(pkgErr))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,58 @@
+package internal
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// WriteFile writes b to dest atomically by writing to a temporary file in the same directory and renaming it.
+// It returns false without touching dest if dest already has the same content.
+func WriteFile(dest string, b []byte) (bool, error) {
+	perm := fs.FileMode(0o644)
+	fileInfo, err := os.Stat(dest)
+	switch {
+	case err == nil:
+		current, err := os.ReadFile(dest)
+		if err != nil {
+			return false, fmt.Errorf("failed to read %s: %w", dest, err)
+		}
+		if bytes.Equal(current, b) {
+			return false, nil
+		}
+		perm = fileInfo.Mode().Perm()
+	case !errors.Is(err, fs.ErrNotExist):
+		return false, fmt.Errorf("failed to stat %s: %w", dest, err)
+	}
+
+	destDir := filepath.Dir(dest)
+	if err := os.MkdirAll(destDir, os.ModePerm); err != nil {
+		return false, fmt.Errorf("failed to create directory %s: %w", destDir, err)
+	}
+	tmp, err := os.CreateTemp(destDir, fmt.Sprintf(".%s.*.tmp", filepath.Base(dest)))
+	if err != nil {
+		return false, fmt.Errorf("failed to create temporary file in %s: %w", destDir, err)
+	}
+	defer func() {
+		// Once renamed, the temporary file no longer exists and this is a no-op.
+		_ = os.Remove(tmp.Name())
+	}()
+	if _, err := tmp.Write(b); err != nil {
+		_ = tmp.Close()
+		return false, fmt.Errorf("failed to write to %s: %w", tmp.Name(), err)
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		_ = tmp.Close()
+		return false, fmt.Errorf("failed to change mode of %s: %w", tmp.Name(), err)
+	}
+	if err := tmp.Close(); err != nil {
+		return false, fmt.Errorf("failed to close %s: %w", tmp.Name(), err)
+	}
+	if err := os.Rename(tmp.Name(), dest); err != nil {
+		return false, fmt.Errorf("failed to rename %s to %s: %w", tmp.Name(), dest, err)
+	}
+	return true, nil
+}
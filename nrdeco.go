@@ -0,0 +1,47 @@
+// Package nrdeco provides runtime helpers for the decorators generated by nrdeco.
+//
+// See here for more information on nrdeco: https://github.com/miyamo2/nrdeco
+package nrdeco
+
+import "context"
+
+// Segment is a segment started by a decorator, such as *newrelic.Segment.
+type Segment interface {
+	End()
+}
+
+type segmentKey struct{}
+
+// NewContext returns a copy of ctx carrying segment.
+//
+// Decorators generated with child contexts call the decorated method with the context returned by NewContext,
+// so that the method and the decorators nested in it can find the segment they run within.
+func NewContext(ctx context.Context, segment Segment) context.Context {
+	return context.WithValue(ctx, segmentKey{}, segment)
+}
+
+// FromContext returns the segment of the closest decorator calling with ctx, or nil if there is none.
+func FromContext(ctx context.Context) Segment {
+	segment, _ := ctx.Value(segmentKey{}).(Segment)
+	return segment
+}
+
+// Unwrap returns the innermost value wrapped by v.
+//
+// Every decorator generated by nrdeco has an Unwrap method returning the decorated value.
+// Unwrap repeatedly calls the Unwrap method while the value has one returning T,
+// so it walks nested decorators like errors.Unwrap does for wrapped errors.
+// If v does not have such a method, Unwrap returns v itself.
+func Unwrap[T any](v T) T {
+	for {
+		u, ok := any(v).(interface{ Unwrap() T })
+		if !ok {
+			return v
+		}
+		inner := u.Unwrap()
+		if any(inner) == nil {
+			return v
+		}
+		v = inner
+	}
+}